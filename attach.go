@@ -0,0 +1,70 @@
+package slog
+
+import (
+	"github.com/kuun/slog/writer"
+)
+
+// attachment is a writer attached to loggers by AttachWriter
+type attachment struct {
+	pattern *loggerPattern
+	wr      *logWriter
+}
+
+// attachments are protected by mu
+var attachments []*attachment
+
+// AttachWriter adds wr to the writers of loggers whose path matches pattern,
+// in addition to the configured writers, records are formatted by format.
+// The writer is kept by reloading configuration until detach is called. wr
+// is owned by the caller, it's run by AttachWriter, but it's not closed by
+// detach or Close.
+func AttachWriter(pattern, format string, wr writer.LogWriter) (detach func(), err error) {
+	p, err := compilePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := getEncoder(format)
+	if err != nil {
+		return nil, err
+	}
+	a := &attachment{pattern: p, wr: &logWriter{LogWriter: wr, encode: enc}}
+	wr.Run()
+	mu.Lock()
+	attachments = append(attachments, a)
+	configAttached(a)
+	mu.Unlock()
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for i, attached := range attachments {
+			if attached == a {
+				attachments = append(attachments[:i:i], attachments[i+1:]...)
+				configAttached(a)
+				return
+			}
+		}
+	}, nil
+}
+
+// configAttached rebuilds writers of loggers a is attached to, levels of
+// the loggers are kept, they may be set by SetLevel.
+func configAttached(a *attachment) {
+	for _, logger := range loggers {
+		if a.pattern.match(logger.fullPath) {
+			_, writerNames := resolveLogger(logger.fullPath)
+			logger.setWriters(appendAttached(getLogWriters(writerNames), logger.fullPath))
+			// recompute the min level of writers
+			logger.setLevel(logger.getLevel())
+		}
+	}
+}
+
+// appendAttached appends writers attached to the logger of path to wrs
+func appendAttached(wrs []*logWriter, path string) []*logWriter {
+	for _, a := range attachments {
+		if a.pattern.match(path) {
+			wrs = append(wrs, a.wr)
+		}
+	}
+	return wrs
+}
@@ -24,8 +24,9 @@ import (
 // Buffer holds a byte Buffer for reuse. The zero value is ready for use.
 type Buffer struct {
 	bytes.Buffer
-	Tmp  [24]byte // temporary byte array for creating headers.
-	next *Buffer
+	Tmp   [24]byte // temporary byte array for creating headers.
+	Level int      // level of the log record in the buffer, set by slog
+	next  *Buffer
 }
 
 // freeList is a list of byte buffers, maintained under freeListMu.
@@ -99,6 +100,7 @@ func GetBuffer() *Buffer {
 		b = new(Buffer)
 	} else {
 		b.next = nil
+		b.Level = 0
 		b.Reset()
 	}
 	return b
@@ -0,0 +1,69 @@
+package slog
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// loggerCtxKey is the context key of the logger stored by NewContext
+type loggerCtxKey struct{}
+
+// contextKey is a context key whose value is written as a field named name
+type contextKey struct {
+	key  interface{}
+	name string
+}
+
+var (
+	ctxKeysMu sync.RWMutex
+	ctxKeys   []contextKey
+)
+
+// RegisterContextKey registers a context key, records written by *Ctx
+// methods have a field named name if the context has a value of key, e.g.
+// a trace id or a tenant. Registering a key again changes its field name.
+func RegisterContextKey(key interface{}, name string) {
+	ctxKeysMu.Lock()
+	defer ctxKeysMu.Unlock()
+	for i := range ctxKeys {
+		if ctxKeys[i].key == key {
+			ctxKeys[i].name = name
+			return
+		}
+	}
+	ctxKeys = append(ctxKeys, contextKey{key: key, name: name})
+}
+
+// contextFields returns fields of registered keys which ctx has values of.
+func contextFields(ctx context.Context) []Field {
+	if ctx == nil {
+		return nil
+	}
+	ctxKeysMu.RLock()
+	defer ctxKeysMu.RUnlock()
+	var fields []Field
+	for _, k := range ctxKeys {
+		if v := ctx.Value(k.key); v != nil {
+			fields = append(fields, Field{Key: k.name, Value: v})
+		}
+	}
+	return fields
+}
+
+// NewContext returns a context carrying logger.
+func NewContext(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, loggerCtxKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the logger of the
+// caller's package if ctx carries no logger.
+func FromContext(ctx context.Context) Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerCtxKey{}).(Logger); ok {
+			return logger
+		}
+	}
+	pc, _, _, _ := runtime.Caller(1)
+	return GetLoggerWithPath(funcPackage(runtime.FuncForPC(pc).Name()))
+}
@@ -0,0 +1,223 @@
+package slog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kuun/slog/buffer"
+)
+
+// log writer formats
+const (
+	// FormatText is the default format, a glog style header followed by
+	// the message and key=value fields
+	FormatText = "text"
+	// FormatJSON formats every record as a json object in one line
+	FormatJSON = "json"
+	// FormatShort is the text format without time and logger path, e.g.
+	// "INFO main.go:12] hello user=42", it's used where lines are already
+	// labelled, e.g. by t.Log
+	FormatShort = "short"
+)
+
+// record is a log record, it's encoded by the encoder of each log writer
+type record struct {
+	time   time.Time
+	level  Level
+	logger *loggerImpl
+	file   string
+	line   int
+	msg    string
+	fields []Field
+}
+
+// encoder encodes a record into a new buffer, the buffer is owned by the
+// writer it's written to.
+type encoder func(r *record) *buffer.Buffer
+
+func getEncoder(format string) (encoder, error) {
+	switch format {
+	case "", FormatText:
+		return encodeText, nil
+	case FormatJSON:
+		return encodeJSON, nil
+	case FormatShort:
+		return encodeShort, nil
+	default:
+		return nil, errors.New("unkown log format: " + format)
+	}
+}
+
+func encodeText(r *record) *buffer.Buffer {
+	buf := formatHeader(r)
+	buf.WriteString(r.msg)
+	writeFields(buf, r.fields)
+	buf.WriteByte('\n')
+	return buf
+}
+
+func encodeShort(r *record) *buffer.Buffer {
+	buf := buffer.GetBuffer()
+	buf.WriteString(r.level.String())
+	buf.WriteByte(' ')
+	buf.WriteString(r.file)
+	buf.WriteByte(':')
+	buf.WriteString(strconv.Itoa(r.line))
+	buf.WriteString("] ")
+	buf.WriteString(r.msg)
+	writeFields(buf, r.fields)
+	buf.WriteByte('\n')
+	return buf
+}
+
+// jsonTimeFormat is RFC3339 with microseconds, the precision of text header
+const jsonTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// encodeJSON encodes a record as a json object in one line, e.g.
+//
+//	{"ts":"2017-06-01T09:26:19.881703+08:00","level":"INFO","logger":"github.com/kuun/slog/demo","file":"main.go","line":12,"msg":"hello","fields":{"user":42}}
+//
+// fields is omitted if the record has no fields.
+func encodeJSON(r *record) *buffer.Buffer {
+	buf := buffer.GetBuffer()
+	buf.WriteString(`{"ts":"`)
+	buf.WriteString(r.time.Format(jsonTimeFormat))
+	buf.WriteString(`","level":"`)
+	buf.WriteString(r.level.String())
+	buf.WriteString(`","logger":`)
+	writeJSONString(buf, r.logger.fullPath)
+	buf.WriteString(`,"file":`)
+	writeJSONString(buf, r.file)
+	buf.WriteString(`,"line":`)
+	buf.WriteString(strconv.Itoa(r.line))
+	buf.WriteString(`,"msg":`)
+	writeJSONString(buf, r.msg)
+	if len(r.fields) > 0 {
+		buf.WriteString(`,"fields":{`)
+		for i, field := range r.fields {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, field.Key)
+			buf.WriteByte(':')
+			writeJSONValue(buf, field.Value)
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteString("}\n")
+	return buf
+}
+
+func writeJSONValue(buf *buffer.Buffer, v interface{}) {
+	switch v.(type) {
+	case error, json.Marshaler, fmt.Stringer:
+		// methods of a typed nil pointer may panic
+		if isNilPointer(v) {
+			buf.WriteString("null")
+			return
+		}
+	}
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case string:
+		writeJSONString(buf, v)
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case int:
+		buf.WriteString(strconv.FormatInt(int64(v), 10))
+	case int32:
+		buf.WriteString(strconv.FormatInt(int64(v), 10))
+	case int64:
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case uint:
+		buf.WriteString(strconv.FormatUint(uint64(v), 10))
+	case uint32:
+		buf.WriteString(strconv.FormatUint(uint64(v), 10))
+	case uint64:
+		buf.WriteString(strconv.FormatUint(v, 10))
+	case float32:
+		writeJSONFloat(buf, float64(v), 32)
+	case float64:
+		writeJSONFloat(buf, v, 64)
+	case error:
+		writeJSONString(buf, v.Error())
+	case json.Marshaler:
+		writeJSONMarshal(buf, v)
+	case fmt.Stringer:
+		writeJSONString(buf, v.String())
+	default:
+		writeJSONMarshal(buf, v)
+	}
+}
+
+func writeJSONFloat(buf *buffer.Buffer, f float64, bitSize int) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		// json has no NaN and Inf, write them as strings
+		writeJSONString(buf, strconv.FormatFloat(f, 'g', -1, bitSize))
+		return
+	}
+	buf.WriteString(strconv.FormatFloat(f, 'g', -1, bitSize))
+}
+
+func writeJSONMarshal(buf *buffer.Buffer, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		writeJSONString(buf, fmt.Sprint(v))
+		return
+	}
+	buf.Write(data)
+}
+
+const hex = "0123456789abcdef"
+
+// writeJSONString writes s as a quoted json string, invalid utf-8 bytes
+// are replaced by U+FFFD.
+func writeJSONString(buf *buffer.Buffer, s string) {
+	buf.WriteByte('"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			buf.WriteString(s[start:i])
+			switch c {
+			case '"', '\\':
+				buf.WriteByte('\\')
+				buf.WriteByte(c)
+			case '\n':
+				buf.WriteString(`\n`)
+			case '\r':
+				buf.WriteString(`\r`)
+			case '\t':
+				buf.WriteString(`\t`)
+			default:
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[c>>4])
+				buf.WriteByte(hex[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf.WriteString(s[start:i])
+			buf.WriteString(`\ufffd`)
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	buf.WriteString(s[start:])
+	buf.WriteByte('"')
+}
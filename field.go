@@ -0,0 +1,121 @@
+package slog
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/kuun/slog/buffer"
+)
+
+// Field is a key-value pair attached to a log record.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F makes a field, it's a shortcut for Field{Key: key, Value: value}.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// key names used when keyvals passed to With or *w can't be paired
+const (
+	badKey       = "!BADKEY"
+	missingValue = "!MISSING"
+)
+
+// makeFields converts alternating keys and values to fields, a Field in
+// keyvals is taken as is.
+func makeFields(keyvals []interface{}) []Field {
+	if len(keyvals) == 0 {
+		return nil
+	}
+	fields := make([]Field, 0, (len(keyvals)+1)/2)
+	for i := 0; i < len(keyvals); i++ {
+		switch kv := keyvals[i].(type) {
+		case Field:
+			fields = append(fields, kv)
+		case string:
+			if i+1 < len(keyvals) {
+				fields = append(fields, Field{Key: kv, Value: keyvals[i+1]})
+				i++
+			} else {
+				fields = append(fields, Field{Key: kv, Value: missingValue})
+			}
+		default:
+			fields = append(fields, Field{Key: badKey, Value: kv})
+		}
+	}
+	return fields
+}
+
+// joinFields returns a new slice holding a followed by b, it never
+// modifies the backing array of a, so child loggers can't overwrite the
+// fields of each other.
+func joinFields(a, b []Field) []Field {
+	if len(b) == 0 {
+		return a
+	}
+	if len(a) == 0 {
+		return b
+	}
+	fields := make([]Field, 0, len(a)+len(b))
+	fields = append(fields, a...)
+	return append(fields, b...)
+}
+
+// writeFields writes fields as " key=value" pairs, keys and values are
+// quoted if they contain spaces, quotes, '=' or non printable characters.
+func writeFields(buf *buffer.Buffer, fields []Field) {
+	for _, field := range fields {
+		buf.WriteByte(' ')
+		writeText(buf, field.Key)
+		buf.WriteByte('=')
+		writeText(buf, fieldString(field.Value))
+	}
+}
+
+func fieldString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case error:
+		if isNilPointer(v) {
+			return "<nil>"
+		}
+		return v.Error()
+	case nil:
+		return "<nil>"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// isNilPointer reports whether v is a nil pointer, e.g. a typed nil error,
+// calling its methods may panic.
+func isNilPointer(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Pointer && rv.IsNil()
+}
+
+func writeText(buf *buffer.Buffer, s string) {
+	if needsQuote(s) {
+		buf.WriteString(strconv.Quote(s))
+	} else {
+		buf.WriteString(s)
+	}
+}
+
+func needsQuote(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r == ' ' || r == '=' || r == '"' || r == utf8.RuneError || !strconv.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
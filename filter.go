@@ -0,0 +1,79 @@
+package slog
+
+import (
+	"errors"
+	"strings"
+)
+
+// recordFilter is the filter expression of a log writer, a record is
+// written by the writer only if it matches all conditions of the filter.
+// Conditions are separated by "&&", e.g.
+//
+//	path^=github.com/org/db && msg~=timeout && user=42
+//
+// supported conditions:
+//
+//	path^=prefix   the logger path starts with prefix
+//	msg~=substr    the message contains substr
+//	key=value      the record has a field key whose value is value
+type recordFilter []filterCond
+
+type filterCond struct {
+	op    string // "^=", "~=" or "="
+	key   string // field key of "="
+	value string
+}
+
+func parseFilter(expr string) (recordFilter, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	var f recordFilter
+	for _, cond := range strings.Split(expr, "&&") {
+		cond = strings.TrimSpace(cond)
+		switch {
+		case strings.HasPrefix(cond, "path^="):
+			f = append(f, filterCond{op: "^=", value: strings.TrimSpace(cond[len("path^="):])})
+		case strings.HasPrefix(cond, "msg~="):
+			f = append(f, filterCond{op: "~=", value: strings.TrimSpace(cond[len("msg~="):])})
+		default:
+			eq := strings.Index(cond, "=")
+			if eq <= 0 {
+				return nil, errors.New("not valid filter condition: '" + cond + "'")
+			}
+			key := strings.TrimSpace(cond[:eq])
+			if strings.ContainsAny(key, "^~") {
+				return nil, errors.New("not valid filter condition: '" + cond + "'")
+			}
+			f = append(f, filterCond{op: "=", key: key, value: strings.TrimSpace(cond[eq+1:])})
+		}
+	}
+	return f, nil
+}
+
+// match reports whether r matches all conditions, an empty filter matches
+// all records.
+func (f recordFilter) match(r *record) bool {
+	for _, cond := range f {
+		if !cond.match(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (cond *filterCond) match(r *record) bool {
+	switch cond.op {
+	case "^=":
+		return strings.HasPrefix(r.logger.fullPath, cond.value)
+	case "~=":
+		return strings.Contains(r.msg, cond.value)
+	default:
+		for _, field := range r.fields {
+			if field.Key == cond.key && fieldString(field.Value) == cond.value {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,192 @@
+package slog
+
+import (
+	"context"
+	stdslog "log/slog"
+	"runtime"
+	"strings"
+)
+
+// levels of log/slog for the levels it doesn't define
+const (
+	StdLevelNotice stdslog.Level = stdslog.LevelInfo + 2
+	StdLevelFatal  stdslog.Level = stdslog.LevelError + 4
+)
+
+// HandlerOptions are options of Handler
+type HandlerOptions struct {
+	// LoggerKey is the key of the attribute holding the logger path, e.g.
+	// "logger". If it's empty or a record has no such attribute, the
+	// package path of the caller is used. Note Enabled doesn't see the
+	// attribute passed to a log call, so the level of the caller's package
+	// filters the record first.
+	LoggerKey string
+}
+
+// Handler is a log/slog.Handler writing records by loggers of slog, so
+// records are filtered by the level and written by the writers configured
+// for the logger path. Attributes are written as fields, keys of attributes
+// in groups are prefixed by group names, e.g. "req.id". Records at or above
+// StdLevelFatal are written as FATAL, but the application doesn't exit.
+type Handler struct {
+	opts   HandlerOptions
+	path   string  // logger path set by WithAttrs
+	fields []Field // attributes added by WithAttrs
+	prefix string  // key prefix of groups opened by WithGroup
+}
+
+// NewHandler creates a handler, nil opts is the same as zero options.
+func NewHandler(opts *HandlerOptions) *Handler {
+	h := &Handler{}
+	if opts != nil {
+		h.opts = *opts
+	}
+	return h
+}
+
+// Enabled reports whether the logger of the handler's path or the caller's
+// package logs records at level.
+func (h *Handler) Enabled(ctx context.Context, level stdslog.Level) bool {
+	path := h.path
+	if path == "" {
+		path = stdCallerPackage()
+	}
+	return h.logger(path).enabled(stdLevel(level))
+}
+
+// Handle writes r by the logger of the path set by the logger attribute,
+// or the caller's package.
+func (h *Handler) Handle(ctx context.Context, r stdslog.Record) error {
+	path := h.path
+	fields := make([]Field, 0, len(h.fields)+r.NumAttrs())
+	fields = append(fields, h.fields...)
+	r.Attrs(func(a stdslog.Attr) bool {
+		if h.prefix == "" && h.isLoggerKey(a) {
+			path = a.Value.String()
+			return true
+		}
+		fields = appendAttr(fields, h.prefix, a)
+		return true
+	})
+
+	frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+	if path == "" {
+		path = funcPackage(frame.Function)
+	}
+	logger := h.logger(path)
+	level := stdLevel(r.Level)
+	if !logger.enabled(level) {
+		return nil
+	}
+	file, line := "???", 1
+	if frame.File != "" {
+		file, line = shortFile(frame.File), frame.Line
+	}
+	logger.write(&record{
+		time:   r.Time,
+		level:  level,
+		file:   file,
+		line:   line,
+		msg:    r.Message,
+		fields: fields,
+	})
+	return nil
+}
+
+// WithAttrs returns a handler writing attrs in every record, the logger
+// attribute sets the logger path of the handler.
+func (h *Handler) WithAttrs(attrs []stdslog.Attr) stdslog.Handler {
+	h2 := *h
+	h2.fields = append([]Field(nil), h.fields...)
+	for _, a := range attrs {
+		if h.prefix == "" && h.isLoggerKey(a) {
+			h2.path = a.Value.String()
+			continue
+		}
+		h2.fields = appendAttr(h2.fields, h.prefix, a)
+	}
+	return &h2
+}
+
+// WithGroup returns a handler prefixing keys of attributes by name.
+func (h *Handler) WithGroup(name string) stdslog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+func (h *Handler) isLoggerKey(a stdslog.Attr) bool {
+	return h.opts.LoggerKey != "" && a.Key == h.opts.LoggerKey
+}
+
+func (h *Handler) logger(path string) *loggerImpl {
+	return GetLoggerWithPath(path).(*loggerImpl)
+}
+
+// appendAttr appends a as fields to fields, attributes of a group are
+// flattened with keys prefixed by the group name.
+func appendAttr(fields []Field, prefix string, a stdslog.Attr) []Field {
+	a.Value = a.Value.Resolve()
+	if a.Equal(stdslog.Attr{}) {
+		return fields
+	}
+	if a.Value.Kind() == stdslog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			fields = appendAttr(fields, prefix, ga)
+		}
+		return fields
+	}
+	return append(fields, Field{Key: prefix + a.Key, Value: a.Value.Any()})
+}
+
+// stdLevel maps a log/slog level to the level of slog
+func stdLevel(level stdslog.Level) Level {
+	switch {
+	case level < stdslog.LevelInfo:
+		return Debug
+	case level < StdLevelNotice:
+		return Info
+	case level < stdslog.LevelWarn:
+		return Notice
+	case level < stdslog.LevelError:
+		return Warn
+	case level < StdLevelFatal:
+		return Error
+	default:
+		return Fatal
+	}
+}
+
+// stdCallerPackage returns the package path of the function calling
+// log/slog, which calls Handler.Enabled.
+func stdCallerPackage() string {
+	var pcs [16]uintptr
+	// skip runtime.Callers, stdCallerPackage and Handler.Enabled
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "log/slog.") {
+			return funcPackage(frame.Function)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// funcPackage returns the package path of a function name returned by
+// runtime, e.g. "github.com/kuun/slog" of "github.com/kuun/slog.(*Handler).Handle".
+func funcPackage(function string) string {
+	slash := strings.LastIndex(function, "/")
+	if dot := strings.Index(function[slash+1:], "."); dot >= 0 {
+		return function[:slash+1+dot]
+	}
+	return function
+}
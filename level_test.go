@@ -0,0 +1,86 @@
+package slog_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kuun/slog"
+	"github.com/kuun/slog/slogtest"
+)
+
+type computer struct {
+	name string
+	core int
+}
+
+func logAll(logger slog.Logger) {
+	testComputer := computer{"mycomputer", 4}
+	format := "my computer is %s, core num is %v"
+
+	logger.Debug("my computer is ", testComputer.name, ", core num is ", testComputer.core)
+	logger.Debugf(format, testComputer.name, testComputer.core)
+	logger.Info("my computer is ", testComputer.name, ", core num is ", testComputer.core)
+	logger.Infof(format, testComputer.name, testComputer.core)
+	logger.Notice("my computer is ", testComputer.name, ", core num is ", testComputer.core)
+	logger.Noticef(format, testComputer.name, testComputer.core)
+	logger.Warn("my computer is ", testComputer.name, ", core num is ", testComputer.core)
+	logger.Warnf(format, testComputer.name, testComputer.core)
+	logger.Error("my computer is ", testComputer.name, ", core num is ", testComputer.core)
+	logger.Errorf(format, testComputer.name, testComputer.core)
+}
+
+func TestLogLevels(t *testing.T) {
+	const path = "github.com/kuun/slog/leveltest"
+	logger := slog.GetLoggerWithPath(path)
+	rec := slogtest.Capture(t, path)
+	levels := []string{slog.LvNameDebug, slog.LvNameInfo, slog.LvNameNotice, slog.LvNameWarn, slog.LvNameError, slog.LvNameFatal}
+	for i, level := range levels {
+		rec.Reset()
+		logger.SetLevel(level)
+		logAll(logger)
+		for j, lv := range levels[:len(levels)-1] {
+			expect := 0
+			if j >= i {
+				expect = 2
+			}
+			records := rec.Level(lv)
+			if len(records) != expect {
+				t.Errorf("level %s: %d %s records, expect: %d", level, len(records), lv, expect)
+				continue
+			}
+			for _, r := range records {
+				if r.Msg != "my computer is mycomputer, core num is 4" || r.File != "level_test.go" {
+					t.Errorf("level %s: record: %+v", level, r)
+				}
+			}
+		}
+	}
+}
+
+// logT is a testing.TB keeping lines written by Log
+type logT struct {
+	testing.TB
+	lines []string
+}
+
+func (t *logT) Log(args ...interface{}) {
+	t.lines = append(t.lines, fmt.Sprint(args...))
+}
+
+func TestNewLogger(t *testing.T) {
+	lt := &logT{TB: t}
+	logger := slogtest.NewLogger(lt)
+	logger.SetLevel(slog.LvNameInfo)
+	logAll(logger)
+	levels := []string{slog.LvNameInfo, slog.LvNameNotice, slog.LvNameWarn, slog.LvNameError}
+	if len(lt.lines) != 2*len(levels) {
+		t.Fatalf("logged lines: %q", lt.lines)
+	}
+	for i, line := range lt.lines {
+		prefix := levels[i/2] + " level_test.go:"
+		if !strings.HasPrefix(line, prefix) || !strings.HasSuffix(line, "] my computer is mycomputer, core num is 4") {
+			t.Errorf("line %d: %q, expect prefix: %q", i, line, prefix)
+		}
+	}
+}
@@ -1,11 +1,13 @@
 package slog
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"runtime"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/kuun/slog/buffer"
@@ -15,218 +17,315 @@ import (
 var levelChars = [6]byte{'D', 'I', 'N', 'W', 'E', 'F'}
 
 type loggerImpl struct {
-	level    Level
-	writers  []writer.LogWriter
+	*loggerCore
 	fullPath string
 	abbrPath string
-
-	// log.Logger.Output callPath
-	callPath int
-
-	debugImpl  func(l *loggerImpl, level Level, v ...interface{})
-	debugfImpl func(l *loggerImpl, level Level, format string, v ...interface{})
-
-	infoImpl  func(l *loggerImpl, level Level, v ...interface{})
-	infofImpl func(l *loggerImpl, level Level, format string, v ...interface{})
-
-	noticeImpl  func(l *loggerImpl, level Level, v ...interface{})
-	noticefImpl func(l *loggerImpl, level Level, format string, v ...interface{})
-
-	warnImpl  func(l *loggerImpl, level Level, v ...interface{})
-	warnfImpl func(l *loggerImpl, level Level, format string, v ...interface{})
-
-	errorImpl  func(l *loggerImpl, level Level, v ...interface{})
-	errorfImpl func(l *loggerImpl, level Level, format string, v ...interface{})
-
-	fatalImpl  func(l *loggerImpl, level Level, v ...interface{})
-	fatalfImpl func(l *loggerImpl, level Level, format string, v ...interface{})
+	// structured fields written by every record, set by With
+	fields []Field
 }
 
-// func suffix is "Y" is valid implements
-// func suffix is "N" is empty implements
-
-func printImplY(l *loggerImpl, level Level, v ...interface{}) {
-	buff := l.header(level)
-	buff.WriteString(fmt.Sprint(v...))
-	buff.WriteByte('\n')
-	for _, wr := range l.writers {
-		wr.Write(buff)
-	}
+// loggerCore holds level and writers of a logger, it's shared by the logger
+// and its children created by With, so configuration reloading applies to
+// all of them. Both are updated atomically, so they can be changed while
+// the logger is in use.
+type loggerCore struct {
+	level   atomic.Int32
+	writers atomic.Pointer[[]*logWriter]
+	// minLevel is the min level of records made by the logger, it's below
+	// level if a writer like RING gets records below level
+	minLevel atomic.Int32
 }
 
-func printN(l *loggerImpl, level Level, v ...interface{}) {
+func (l *loggerImpl) GetLevel() string {
+	return l.getLevel().String()
 }
 
-func printfImplY(l *loggerImpl, level Level, format string, v ...interface{}) {
-	buff := l.header(level)
-	buff.WriteString(fmt.Sprintf(format, v...))
-	buff.WriteByte('\n')
-	for _, wr := range l.writers {
-		wr.Write(buff)
+func (l *loggerImpl) SetLevel(level string) error {
+	lv, ok := parseLevel(level)
+	if !ok {
+		return errors.New("unkown log level")
 	}
+	l.setLevel(lv)
+	return nil
 }
 
-func printfImplN(l *loggerImpl, level Level, format string, v ...interface{}) {
+func (c *loggerCore) getLevel() Level {
+	return Level(c.level.Load())
 }
 
-func (l *loggerImpl) GetLevel() string {
-	return l.level.String()
+// setLevel sets the level, and the min level by writers of the logger.
+func (c *loggerCore) setLevel(lv Level) {
+	c.level.Store(int32(lv))
+	minLevel := lv
+	if wrs := c.writers.Load(); wrs != nil {
+		for _, wr := range *wrs {
+			if wr.belowLevel && wr.level < minLevel {
+				minLevel = wr.level
+			}
+		}
+	}
+	c.minLevel.Store(int32(minLevel))
 }
 
-func (l *loggerImpl) SetLevel(level string) error {
-	if lv, ok := parseLevel(level); ok {
-		l.level = lv
-	} else {
-		return errors.New("unkown log level")
-	}
-	// init all print func
-	l.debugImpl = printN
-	l.debugfImpl = printfImplN
-
-	l.infoImpl = printN
-	l.infofImpl = printfImplN
-
-	l.noticeImpl = printN
-	l.noticefImpl = printfImplN
-
-	l.warnImpl = printN
-	l.warnfImpl = printfImplN
-
-	l.errorImpl = printN
-	l.errorfImpl = printfImplN
-
-	// log that level is PANIC and FATAL must be output
-	switch l.level {
-	case Debug:
-		l.debugImpl = printImplY
-		l.debugfImpl = printfImplY
-		fallthrough
-	case Info:
-		l.infoImpl = printImplY
-		l.infofImpl = printfImplY
-		fallthrough
-	case Notice:
-		l.noticeImpl = printImplY
-		l.noticefImpl = printfImplY
-		fallthrough
-	case Warn:
-		l.warnImpl = printImplY
-		l.warnfImpl = printfImplY
-		fallthrough
-	case Error:
-		l.errorImpl = printImplY
-		l.errorfImpl = printfImplY
-		fallthrough
-	case Fatal:
-		l.fatalImpl = printImplY
-		l.fatalfImpl = printfImplY
-	}
-	return nil
+func (c *loggerCore) setWriters(wrs []*logWriter) {
+	c.writers.Store(&wrs)
 }
 
 func (l *loggerImpl) Above(lv Level) bool {
-	return lv >= l.level
+	return lv >= l.getLevel()
+}
+
+// enabled reports whether the logger makes records at lv, it's true for
+// records below the level of the logger if a writer gets them.
+func (c *loggerCore) enabled(lv Level) bool {
+	return int32(lv) >= c.minLevel.Load()
 }
 
 func (l *loggerImpl) IsDebugEnabled() bool {
-	return Debug == l.level
+	return l.Above(Debug)
 }
 
 func (l *loggerImpl) IsInfoEnabled() bool {
-	return Info >= l.level
+	return l.Above(Info)
 }
 
 func (l *loggerImpl) IsNoticeEnabled() bool {
-	return Notice >= l.level
+	return l.Above(Notice)
 }
 
 func (l *loggerImpl) IsWarnEnabled() bool {
-	return Warn >= l.level
+	return l.Above(Warn)
 }
 
 func (l *loggerImpl) IsErrorEnabled() bool {
-	return Error >= l.level
+	return l.Above(Error)
 }
 
 func (l *loggerImpl) IsFatalEnabled() bool {
-	return Fatal >= l.level
+	return l.Above(Fatal)
 }
 
 // Debug
 func (l *loggerImpl) Debug(v ...interface{}) {
-	var level Level = Debug
-	l.debugImpl(l, level, v...)
+	if l.enabled(Debug) {
+		l.output(Debug, fmt.Sprint(v...), l.fields)
+	}
 }
 
 func (l *loggerImpl) Debugf(format string, v ...interface{}) {
-	var level Level = Debug
-	l.debugfImpl(l, level, format, v...)
+	if l.enabled(Debug) {
+		l.output(Debug, fmt.Sprintf(format, v...), l.fields)
+	}
 }
 
 // Info
 func (l *loggerImpl) Info(v ...interface{}) {
-	var level Level = Info
-	l.infoImpl(l, level, v...)
+	if l.enabled(Info) {
+		l.output(Info, fmt.Sprint(v...), l.fields)
+	}
 }
 
 func (l *loggerImpl) Infof(format string, v ...interface{}) {
-	var level Level = Info
-	l.infofImpl(l, level, format, v...)
+	if l.enabled(Info) {
+		l.output(Info, fmt.Sprintf(format, v...), l.fields)
+	}
 }
 
 // Notice
 func (l *loggerImpl) Notice(v ...interface{}) {
-	var level Level = Notice
-	l.noticeImpl(l, level, v...)
+	if l.enabled(Notice) {
+		l.output(Notice, fmt.Sprint(v...), l.fields)
+	}
 }
 
 func (l *loggerImpl) Noticef(format string, v ...interface{}) {
-	var level Level = Notice
-	l.noticefImpl(l, level, format, v...)
+	if l.enabled(Notice) {
+		l.output(Notice, fmt.Sprintf(format, v...), l.fields)
+	}
 }
 
 // Warn
 func (l *loggerImpl) Warn(v ...interface{}) {
-	var level Level = Warn
-	l.warnImpl(l, level, v...)
+	if l.enabled(Warn) {
+		l.output(Warn, fmt.Sprint(v...), l.fields)
+	}
 }
 
 func (l *loggerImpl) Warnf(format string, v ...interface{}) {
-	var level Level = Warn
-	l.warnfImpl(l, level, format, v...)
+	if l.enabled(Warn) {
+		l.output(Warn, fmt.Sprintf(format, v...), l.fields)
+	}
 }
 
 // Error
 func (l *loggerImpl) Error(v ...interface{}) {
-	var level Level = Error
-	l.errorImpl(l, level, v...)
+	if l.enabled(Error) {
+		l.output(Error, fmt.Sprint(v...), l.fields)
+	}
 }
 
 func (l *loggerImpl) Errorf(format string, v ...interface{}) {
-	var level Level = Error
-	l.errorfImpl(l, level, format, v...)
+	if l.enabled(Error) {
+		l.output(Error, fmt.Sprintf(format, v...), l.fields)
+	}
 }
 
-// Fatal
+// Fatal, log that level is FATAL must be output
 func (l *loggerImpl) Fatal(v ...interface{}) {
-	var level Level = Fatal
-	l.fatalImpl(l, level, v...)
+	l.output(Fatal, fmt.Sprint(v...), l.fields)
+	l.flush()
 	panic(fmt.Sprint(v...))
 }
 
 func (l *loggerImpl) Fatalf(format string, v ...interface{}) {
-	var level Level = Fatal
-	l.fatalfImpl(l, level, format, v...)
+	l.output(Fatal, fmt.Sprintf(format, v...), l.fields)
+	l.flush()
 	os.Exit(1)
 }
 
+// With returns a child logger which shares level and writers with l,
+// keyvals are appended to the fields of l.
+func (l *loggerImpl) With(keyvals ...interface{}) Logger {
+	return &loggerImpl{
+		loggerCore: l.loggerCore,
+		fullPath:   l.fullPath,
+		abbrPath:   l.abbrPath,
+		fields:     joinFields(l.fields, makeFields(keyvals)),
+	}
+}
+
+func (l *loggerImpl) Debugw(msg string, keyvals ...interface{}) {
+	if l.enabled(Debug) {
+		l.output(Debug, msg, joinFields(l.fields, makeFields(keyvals)))
+	}
+}
+
+func (l *loggerImpl) Infow(msg string, keyvals ...interface{}) {
+	if l.enabled(Info) {
+		l.output(Info, msg, joinFields(l.fields, makeFields(keyvals)))
+	}
+}
+
+func (l *loggerImpl) Noticew(msg string, keyvals ...interface{}) {
+	if l.enabled(Notice) {
+		l.output(Notice, msg, joinFields(l.fields, makeFields(keyvals)))
+	}
+}
+
+func (l *loggerImpl) Warnw(msg string, keyvals ...interface{}) {
+	if l.enabled(Warn) {
+		l.output(Warn, msg, joinFields(l.fields, makeFields(keyvals)))
+	}
+}
+
+func (l *loggerImpl) Errorw(msg string, keyvals ...interface{}) {
+	if l.enabled(Error) {
+		l.output(Error, msg, joinFields(l.fields, makeFields(keyvals)))
+	}
+}
+
+func (l *loggerImpl) Fatalw(msg string, keyvals ...interface{}) {
+	l.output(Fatal, msg, joinFields(l.fields, makeFields(keyvals)))
+	l.flush()
+	panic(msg)
+}
+
+func (l *loggerImpl) DebugCtx(ctx context.Context, v ...interface{}) {
+	if l.enabled(Debug) {
+		l.output(Debug, fmt.Sprint(v...), joinFields(l.fields, contextFields(ctx)))
+	}
+}
+
+func (l *loggerImpl) InfoCtx(ctx context.Context, v ...interface{}) {
+	if l.enabled(Info) {
+		l.output(Info, fmt.Sprint(v...), joinFields(l.fields, contextFields(ctx)))
+	}
+}
+
+func (l *loggerImpl) NoticeCtx(ctx context.Context, v ...interface{}) {
+	if l.enabled(Notice) {
+		l.output(Notice, fmt.Sprint(v...), joinFields(l.fields, contextFields(ctx)))
+	}
+}
+
+func (l *loggerImpl) WarnCtx(ctx context.Context, v ...interface{}) {
+	if l.enabled(Warn) {
+		l.output(Warn, fmt.Sprint(v...), joinFields(l.fields, contextFields(ctx)))
+	}
+}
+
+func (l *loggerImpl) ErrorCtx(ctx context.Context, v ...interface{}) {
+	if l.enabled(Error) {
+		l.output(Error, fmt.Sprint(v...), joinFields(l.fields, contextFields(ctx)))
+	}
+}
+
+func (l *loggerImpl) FatalCtx(ctx context.Context, v ...interface{}) {
+	l.output(Fatal, fmt.Sprint(v...), joinFields(l.fields, contextFields(ctx)))
+	l.flush()
+	panic(fmt.Sprint(v...))
+}
+
+// output makes a record located at the caller of the log method, and writes
+// it to all writers of the logger, it must be called by log methods directly.
+func (l *loggerImpl) output(lv Level, msg string, fields []Field) {
+	_, file, line, ok := runtime.Caller(2)
+	if !ok {
+		file = "???"
+		line = 1
+	} else {
+		file = shortFile(file)
+	}
+	l.write(&record{
+		time:   time.Now(),
+		level:  lv,
+		file:   file,
+		line:   line,
+		msg:    msg,
+		fields: fields,
+	})
+}
+
+// write writes r to all writers of the logger selecting it, each writer
+// gets a buffer encoded in its own format.
+func (l *loggerImpl) write(r *record) {
+	r.logger = l
+	level := l.getLevel()
+	for _, wr := range *l.writers.Load() {
+		if r.level < wr.level || (r.level < level && !wr.belowLevel) || !wr.filter.match(r) {
+			continue
+		}
+		buf := wr.encode(r)
+		buf.Level = int(r.level)
+		wr.Write(buf)
+	}
+}
+
+// flush writes records queued by writers of the logger, it's called before
+// the application exits or panics by a FATAL record.
+func (c *loggerCore) flush() {
+	for _, wr := range *c.writers.Load() {
+		if f, ok := wr.LogWriter.(writer.Flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
+// shortFile returns the file name without directories
+func shortFile(file string) string {
+	if slash := strings.LastIndex(file, "/"); slash >= 0 {
+		return file[slash+1:]
+	}
+	return file
+}
+
 // these codes are from github/golang/glog
 //
-// header formats a log header and returns a buffer containing the formatted
-// header and the user's file and line number.
+// formatHeader formats a log header and returns a buffer containing the
+// formatted header and the user's file and line number.
 // Log lines have this form:
 //
-//	L mmdd hh:mm:ss.uuuuuu threadid file:line] msg...
+//	L mmdd hh:mm:ss.uuuuuu path/file:line] msg...
 //
 // where the fields are defined as follows:
 //
@@ -234,27 +333,13 @@ func (l *loggerImpl) Fatalf(format string, v ...interface{}) {
 //	mm               The month (zero padded; ie May is '05')
 //	dd               The day (zero padded)
 //	hh:mm:ss.uuuuuu  Time in hours, minutes and fractional seconds
-//	threadid         The space-padded thread ID as returned by GetTID()
+//	path             The abbreviated logger path
 //	file             The file name
 //	line             The line number
 //	msg              The user-supplied message
-func (l *loggerImpl) header(lv Level) *buffer.Buffer {
-	_, file, line, ok := runtime.Caller(3)
-	if !ok {
-		file = "???"
-		line = 1
-	} else {
-		slash := strings.LastIndex(file, "/")
-		if slash >= 0 {
-			file = file[slash+1:]
-		}
-	}
-	return l.formatHeader(lv, file, line)
-}
-
-// formatHeader formats a log header using the provided file name and line number.
-func (l *loggerImpl) formatHeader(lv Level, file string, line int) *buffer.Buffer {
-	now := time.Now()
+func formatHeader(r *record) *buffer.Buffer {
+	now := r.time
+	line := r.line
 	if line < 0 {
 		line = 0 // not a real line number, but acceptable to someDigits
 	}
@@ -264,8 +349,8 @@ func (l *loggerImpl) formatHeader(lv Level, file string, line int) *buffer.Buffe
 	// It's worth about 3X. Fprintf is hard.
 	_, month, day := now.Date()
 	hour, minute, second := now.Clock()
-	// Lmmdd hh:mm:ss.uuuuuu threadid file:line]
-	buf.Tmp[0] = levelChars[lv]
+	// Lmmdd hh:mm:ss.uuuuuu path/file:line]
+	buf.Tmp[0] = levelChars[r.level]
 	buf.Tmp[1] = ' '
 	buf.TwoDigits(2, int(month))
 	buf.TwoDigits(4, day)
@@ -279,9 +364,9 @@ func (l *loggerImpl) formatHeader(lv Level, file string, line int) *buffer.Buffe
 	buf.NDigits(6, 16, now.Nanosecond()/1000, '0')
 	buf.Tmp[22] = ' '
 	buf.Write(buf.Tmp[:23])
-	buf.WriteString(l.abbrPath)
+	buf.WriteString(r.logger.abbrPath)
 	buf.WriteByte('/')
-	buf.WriteString(file)
+	buf.WriteString(r.file)
 	buf.Tmp[0] = ':'
 	n := buf.SomeDigits(1, line)
 	buf.Tmp[n+1] = ']'
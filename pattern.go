@@ -0,0 +1,97 @@
+package slog
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// prefix of regular expression patterns
+const regexPrefix = "regex:"
+
+// loggerPattern is a compiled LoggerConfig.Pattern. A pattern is a glob
+// matching logger paths, wildcards are:
+//
+//	"*"   matches any characters except '/', but a '*' at the beginning or
+//	      the end of the pattern matches any characters, so "*" matches all
+//	"**"  matches any characters, "a/**/b" matches "a/b", "a/x/b", "a/x/y/b"
+//	"?"   matches one character except '/'
+//
+// A pattern without wildcards matches the path and its sub packages. A
+// pattern prefixed by "regex:" is a regular expression which must match the
+// whole path.
+type loggerPattern struct {
+	re *regexp.Regexp
+	// specificity is how specific the pattern is, the more literal
+	// characters a pattern has, the more specific it is, and a pattern
+	// without wildcards is more specific than a pattern with the same
+	// literal characters but wildcards.
+	specificity int
+}
+
+func compilePattern(pattern string) (*loggerPattern, error) {
+	if pattern == "" {
+		return nil, errors.New("logger pattern is empty")
+	}
+	if strings.HasPrefix(pattern, regexPrefix) {
+		expr := pattern[len(regexPrefix):]
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, errors.New("invalid logger pattern '" + pattern + "': " + err.Error())
+		}
+		prefix, _ := re.LiteralPrefix()
+		re = regexp.MustCompile("^(?:" + expr + ")$")
+		return &loggerPattern{re: re, specificity: len(prefix) * 2}, nil
+	}
+
+	var expr strings.Builder
+	literals := 0
+	wild := false
+	expr.WriteByte('^')
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '*' && strings.HasPrefix(pattern[i:], "**"):
+			wild = true
+			i++
+			if strings.HasSuffix(expr.String(), "/") && strings.HasPrefix(pattern[i+1:], "/") {
+				// "/**/" matches one or more segments, or just "/"
+				expr.WriteString("(?:.*/)?")
+				i++
+			} else {
+				expr.WriteString(".*")
+			}
+		case c == '*':
+			wild = true
+			if i == 0 || i == len(pattern)-1 {
+				expr.WriteString(".*")
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case c == '?':
+			wild = true
+			expr.WriteString("[^/]")
+		default:
+			literals++
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	if !wild {
+		// a pattern without wildcards is the parent of its sub packages
+		expr.WriteString("(?:/.*)?")
+	}
+	expr.WriteByte('$')
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, errors.New("invalid logger pattern '" + pattern + "': " + err.Error())
+	}
+	specificity := literals * 2
+	if !wild {
+		specificity++
+	}
+	return &loggerPattern{re: re, specificity: specificity}, nil
+}
+
+func (p *loggerPattern) match(path string) bool {
+	return p.re.MatchString(path)
+}
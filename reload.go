@@ -0,0 +1,90 @@
+package slog
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Reload re-reads the configuration file specified by environment
+// SLOG_CONF_FILE, and applies it to all created loggers, so levels set by
+// SetLevel are overridden. Writers removed from the configuration or
+// changed are flushed and closed. Current configuration is kept if the file
+// is invalid.
+func Reload() error {
+	c, err := loadConf(os.Getenv("SLOG_CONF_FILE"))
+	if err != nil {
+		return err
+	}
+	return applyConf(c)
+}
+
+func reloadInBackground() {
+	if err := Reload(); err != nil {
+		fmt.Fprintf(os.Stderr, "slog reload error: %s\n", err)
+	}
+}
+
+// ReloadOnSignal reloads configuration whenever one of sigs is received,
+// SIGHUP is used if sigs is empty. Calling stop stops reloading.
+func ReloadOnSignal(sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+	sigChn := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigChn, sigs...)
+	go func() {
+		for {
+			select {
+			case <-sigChn:
+				reloadInBackground()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigChn)
+		close(done)
+	}
+}
+
+// WatchConfFile checks the configuration file every interval, and reloads
+// it when its modification time or size is changed. Calling stop stops
+// watching.
+func WatchConfFile(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var last os.FileInfo
+		if confFile := os.Getenv("SLOG_CONF_FILE"); confFile != "" {
+			last, _ = os.Stat(confFile)
+		}
+		for {
+			select {
+			case <-ticker.C:
+				confFile := os.Getenv("SLOG_CONF_FILE")
+				if confFile == "" {
+					continue
+				}
+				info, err := os.Stat(confFile)
+				if err != nil {
+					continue
+				}
+				if last == nil || !info.ModTime().Equal(last.ModTime()) || info.Size() != last.Size() {
+					last = info
+					reloadInBackground()
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
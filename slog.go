@@ -4,6 +4,7 @@
 package slog
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,7 +12,11 @@ import (
 	"os"
 	"reflect"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/kuun/slog/writer"
 )
@@ -112,107 +117,510 @@ type Logger interface {
 
 	Fatal(v ...interface{})
 	Fatalf(fmt string, v ...interface{})
+
+	// With returns a child logger, the child logger writes keyvals as
+	// structured fields of every record, in addition to the fields of
+	// its parent. keyvals are alternating keys and values, a Field can
+	// also be passed as is.
+	With(keyvals ...interface{}) Logger
+
+	// *w writes msg followed by the logger's fields and keyvals
+	Debugw(msg string, keyvals ...interface{})
+	Infow(msg string, keyvals ...interface{})
+	Noticew(msg string, keyvals ...interface{})
+	Warnw(msg string, keyvals ...interface{})
+	Errorw(msg string, keyvals ...interface{})
+	Fatalw(msg string, keyvals ...interface{})
+
+	// *Ctx writes values of context keys registered by RegisterContextKey
+	// as fields, in addition to the logger's fields
+	DebugCtx(ctx context.Context, v ...interface{})
+	InfoCtx(ctx context.Context, v ...interface{})
+	NoticeCtx(ctx context.Context, v ...interface{})
+	WarnCtx(ctx context.Context, v ...interface{})
+	ErrorCtx(ctx context.Context, v ...interface{})
+	FatalCtx(ctx context.Context, v ...interface{})
 }
 
-type writerConf struct {
+// WriterConfig is the configuration of a log writer
+type WriterConfig struct {
 	// Name is log writer name
 	Name string `json:"name"`
-	// Type is log writer type, valid value: "FILE"
+	// Type is log writer type, valid value: "FILE"(default), "SYSLOG",
+	// "TCP", "UDP", "HTTP", "RING", or a type registered by writer.Register
 	// note: type "STD" is used only by slog, user can't use it
 	Type string `json:"type"`
-	// File is a log file, valid only when the Type is "FILE"
+	// File is a log file, valid only when the Type is "FILE". It can be a
+	// time pattern like "/var/log/app-%Y%m%d.log", the writer switches to
+	// a new file every period, supported conversions: %Y %y %m %d %H %M %%
 	File string `json:"file"`
+	// Link is a symbolic link always pointing to current log file
+	Link string `json:"link"`
+	// Format is the format of records written by the writer, valid value:
+	// "text"(default), "json"
+	Format string `json:"format"`
+	// Level is the min level name of records written by the writer,
+	// default "DEBUG". It applies after the level of the logger
+	Level string `json:"level"`
+	// Filter is an expression records must match to be written by the
+	// writer, conditions are separated by "&&", e.g.
+	// "path^=github.com/org/db && msg~=timeout && user=42"
+	Filter string `json:"filter"`
+	// MaxSize is the max size in megabytes of log file before it's rotated,
+	// 0 disables size based rotation
+	MaxSize int `json:"maxSize"`
+	// MaxBackups is the max count of rotated log files to keep, 0 keeps all
+	MaxBackups int `json:"maxBackups"`
+	// MaxAge is the max days to keep rotated log files, 0 keeps all
+	MaxAge int `json:"maxAge"`
+	// Compress compresses rotated log files with gzip in background
+	Compress bool `json:"compress"`
+	// BufferSize is the size in bytes of the buffer coalescing writes of
+	// "FILE" writer, 0 disables buffering. Buffered data is flushed every
+	// FlushInterval, after ERROR and FATAL records, and by Flush
+	BufferSize int `json:"bufferSize"`
+	// Network is the network of syslog server, valid only when the Type is
+	// "SYSLOG": "udp", "tcp", "unix", "unixgram", or empty for local syslog
+	Network string `json:"network"`
+	// Address is the address of syslog server or collector of "TCP" and
+	// "UDP" writers, e.g. "localhost:514"
+	Address string `json:"address"`
+	// Facility is the syslog facility name, e.g. "local0", default "user"
+	Facility string `json:"facility"`
+	// AppName is the syslog APP-NAME, default is the program name
+	AppName string `json:"appName"`
+	// Backlog is the max count of lines held by "TCP" and "UDP" writers
+	// while disconnected, default 1000
+	Backlog int `json:"backlog"`
+	// Size is the count of lines kept by "RING" writer, default 1000
+	Size int `json:"size"`
+	// Target is the name of the writer which "RING" writer dumps lines to
+	Target string `json:"target"`
+	// URL is the ingestion endpoint of "HTTP" writer
+	URL string `json:"url"`
+	// Headers are added to every request of "HTTP" writer
+	Headers map[string]string `json:"headers"`
+	// BatchLines, BatchBytes and FlushInterval(milliseconds) limit batches
+	// of "HTTP" writer, a batch is posted once it reaches any of them,
+	// defaults are 100 lines, 1MB and 1000ms. FlushInterval is the flush
+	// interval of buffered "FILE" writer too
+	BatchLines    int `json:"batchLines"`
+	BatchBytes    int `json:"batchBytes"`
+	FlushInterval int `json:"flushInterval"`
+	// Gzip compresses request bodies of "HTTP" writer
+	Gzip bool `json:"gzip"`
+	// MaxRetries is the max retries of a batch of "HTTP" writer failed by
+	// network errors or 5xx responses, default 3, negative means no retry
+	MaxRetries int `json:"maxRetries"`
+	// QueueSize is the capacity of the queue between loggers and the
+	// writer, 0 means the default size of the writer type
+	QueueSize int `json:"queueSize"`
+	// Overflow is the policy when the queue is full, valid value:
+	// "block"(default), "drop-newest", "drop-oldest", "drop-below-level"
+	Overflow string `json:"overflow"`
+	// OverflowLevel is the level name, records below it are dropped when
+	// the queue is full by "drop-below-level", default "WARN"
+	OverflowLevel string `json:"overflowLevel"`
+	// Options are passed to the factory of a type registered by
+	// writer.Register
+	Options map[string]interface{} `json:"options"`
 }
 
-type logConf struct {
-	Pattern string   `json:"pattern"`
-	Level   string   `json:"level"`
+// LoggerConfig is the configuration of loggers whose path matches Pattern.
+// If a path is matched by several patterns, the most specific one wins, and
+// the level and writers it doesn't set are inherited from less specific
+// ones, as if those patterns were its parents.
+type LoggerConfig struct {
+	// Pattern is a glob matching logger paths, e.g. "github.com/org/*",
+	// "*/internal/*", "github.com/org/**/db", or a regular expression
+	// prefixed by "regex:". A pattern without wildcards matches the path
+	// and its sub packages.
+	Pattern string `json:"pattern"`
+	// Level is the log level name, e.g. "DEBUG", inherited if empty
+	Level string `json:"level"`
+	// Writers are names of log writers, inherited if empty
 	Writers []string `json:"writers"`
+	// Additive adds Writers to the inherited writers instead of replacing
+	// them
+	Additive bool `json:"additive"`
+}
+
+// Config is the configuration of slog, it's the json object in the file
+// specified by environment SLOG_CONF_FILE, or passed to Configure.
+type Config struct {
+	Writers []WriterConfig `json:"writers"`
+	Loggers []LoggerConfig `json:"loggers"`
 }
 
-type configration struct {
-	Writers []writerConf `json:"writers"`
-	Loggers []logConf    `json:"loggers"`
+// logWriter is a log writer with the encoder formatting records for it
+type logWriter struct {
+	writer.LogWriter
+	encode encoder
+	// level and filter select records written by the writer
+	level  Level
+	filter recordFilter
+	// belowLevel means the writer gets records below the level of loggers
+	belowLevel bool
+	// conf is the configuration which creates the writer, a writer is
+	// reused by reloading if its configuration isn't changed
+	conf WriterConfig
+	// closed is set by Close, a closed writer is never reused, it's
+	// protected by mu
+	closed bool
 }
 
+// mu protects conf, patterns, loggers and writers
+var mu sync.RWMutex
+
 // all loggers, indexed by logger full path
-var loggers = make(map[string]Logger)
+var loggers = make(map[string]*loggerImpl)
 
 // all log writers, indexed by writer name
-var writers = make(map[string]writer.LogWriter)
+var writers = make(map[string]*logWriter)
 
-var conf configration
+var conf Config
+
+// compiled patterns of conf.Loggers
+var patterns []*loggerPattern
+
+// initErr is the error of loading configuration file at initialization
+var initErr error
 
 func init() {
-	var data []byte
-	var err error
-
-	confFile := os.Getenv("SLOG_CONF_FILE")
-	if confFile != "" {
-		if data, err = ioutil.ReadFile(confFile); err != nil {
-			fmt.Printf("slog read file '%s' error: %s", confFile, err)
-			goto FAIL
-		}
-		if err = json.Unmarshal(data, &conf); err != nil {
-			fmt.Printf("slog parse config file '%s' error: %s", confFile, err)
-			goto FAIL
+	loadInitConf()
+}
+
+// loadInitConf loads the configuration file at initialization, its error is
+// returned by InitError.
+func loadInitConf() {
+	initErr = initConf()
+}
+
+// initConf loads the configuration file specified by environment
+// SLOG_CONF_FILE. If the file is invalid, the default configuration is used,
+// unless environment SLOG_STRICT is true, in which case the application
+// exits.
+func initConf() error {
+	c, err := loadConf(os.Getenv("SLOG_CONF_FILE"))
+	if err == nil {
+		err = applyConf(c)
+	}
+	if err == nil {
+		return nil
+	}
+	if strict, _ := strconv.ParseBool(os.Getenv("SLOG_STRICT")); strict {
+		fmt.Fprintf(os.Stderr, "slog %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "slog %s, use the default configuration\n", err)
+	applyConf(Config{})
+	return err
+}
+
+// InitError returns the error of loading the configuration file at
+// initialization, the default configuration is used if it's not nil.
+func InitError() error {
+	return initErr
+}
+
+// Configure verifies cfg and applies it to all loggers, like Reload, an
+// error is returned and current configuration is kept if cfg is invalid.
+func Configure(cfg Config) error {
+	c := Config{
+		Writers: make([]WriterConfig, 0, len(cfg.Writers)),
+		Loggers: make([]LoggerConfig, 0, len(cfg.Loggers)),
+	}
+	for _, wrConf := range cfg.Writers {
+		if wrConf.Headers != nil {
+			headers := make(map[string]string, len(wrConf.Headers))
+			for key, value := range wrConf.Headers {
+				headers[key] = value
+			}
+			wrConf.Headers = headers
 		}
+		wrConf.Options = copyOptions(wrConf.Options)
+		c.Writers = append(c.Writers, wrConf)
+	}
+	for _, logConf := range cfg.Loggers {
+		logConf.Writers = append([]string(nil), logConf.Writers...)
+		c.Loggers = append(c.Loggers, logConf)
+	}
+	return applyConf(c)
+}
+
+// loadConf reads configuration from confFile, the configuration is empty
+// if confFile is empty.
+func loadConf(confFile string) (c Config, err error) {
+	if confFile == "" {
+		return c, nil
+	}
+	data, err := ioutil.ReadFile(confFile)
+	if err != nil {
+		return c, fmt.Errorf("read file '%s' error: %s", confFile, err)
+	}
+	if err = json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("parse config file '%s' error: %s", confFile, err)
+	}
+	return c, nil
+}
+
+// applyConf makes c current configuration and applies it to all created
+// loggers, writers not used any more are flushed and closed. Current
+// configuration is kept if c is invalid.
+func applyConf(c Config) error {
+	mu.Lock()
+	wrs, err := initWriters(c.Writers)
+	if err != nil {
+		mu.Unlock()
+		return fmt.Errorf("init writers error: %s", err)
 	}
-	if err = initWriters(); err != nil {
-		fmt.Printf("slog init writers error: %s", err)
-		goto FAIL
+	ps, err := verifyConf(&c, wrs)
+	if err != nil {
+		mu.Unlock()
+		closeWriters(wrs, writers)
+		return fmt.Errorf("config file is invalid: '%s'", err)
 	}
-	if err = verifyConf(); err != nil {
-		fmt.Printf("config file is invalid: '%s'", err)
-		goto FAIL
+	oldWriters := writers
+	conf, writers, patterns = c, wrs, ps
+	for _, logger := range loggers {
+		configLogger(logger)
 	}
-	return
-FAIL:
-	os.Exit(1)
+	mu.Unlock()
+	closeWriters(oldWriters, writers)
+	return nil
 }
 
-func initWriters() error {
-	for _, wrConf := range conf.Writers {
-		if wrConf.Type == writer.FILE {
-			return errors.New("not valid writer type: " + wrConf.Type)
+// initWriters creates writers configured by wrConfs, current writers are
+// reused if their configuration is not changed.
+func initWriters(wrConfs []WriterConfig) (map[string]*logWriter, error) {
+	wrs := make(map[string]*logWriter)
+	for _, wrConf := range wrConfs {
+		if wrs[wrConf.Name] != nil {
+			closeWriters(wrs, writers)
+			return nil, errors.New("writer name is duplicated: " + wrConf.Name)
+		}
+		if wr := writers[wrConf.Name]; wr != nil && !wr.closed && reflect.DeepEqual(wr.conf, wrConf) {
+			wrs[wrConf.Name] = wr
+			continue
 		}
-		wr, err := writer.NewFileWriter(wrConf.Name, wrConf.File)
+		wr, err := newLogWriter(wrConf)
 		if err != nil {
-			return err
+			closeWriters(wrs, writers)
+			return nil, err
 		}
-		if writers[wrConf.Name] != nil {
-			return errors.New("writer name is duplicated: " + wrConf.Name)
+		wrs[wrConf.Name] = wr
+	}
+	return wrs, nil
+}
+
+func newLogWriter(wrConf WriterConfig) (*logWriter, error) {
+	enc, err := getEncoder(wrConf.Format)
+	if err != nil {
+		return nil, err
+	}
+	level := Level(Debug)
+	if wrConf.Level != "" {
+		var ok bool
+		if level, ok = parseLevel(wrConf.Level); !ok {
+			return nil, errors.New("unkown writer level: " + wrConf.Level)
+		}
+	}
+	filter, err := parseFilter(wrConf.Filter)
+	if err != nil {
+		return nil, err
+	}
+	queue, err := queueOptions(wrConf)
+	if err != nil {
+		return nil, err
+	}
+	var wr writer.LogWriter
+	switch wrConf.Type {
+	case "", writer.FILE:
+		wr, err = newFileWriter(wrConf, queue)
+	case writer.SYSLOG:
+		wr, err = writer.NewSyslogWriter(wrConf.Name, writer.SyslogOptions{
+			Network:  wrConf.Network,
+			Address:  wrConf.Address,
+			Facility: wrConf.Facility,
+			AppName:  wrConf.AppName,
+			Queue:    queue,
+		})
+	case writer.TCP, writer.UDP:
+		wr, err = writer.NewNetWriter(writer.Type(wrConf.Type), wrConf.Name, wrConf.Address, writer.NetOptions{
+			Backlog: wrConf.Backlog,
+			Queue:   queue,
+		})
+	case writer.HTTP:
+		wr, err = writer.NewHTTPWriter(wrConf.Name, wrConf.URL, writer.HTTPOptions{
+			Headers:       wrConf.Headers,
+			BatchLines:    wrConf.BatchLines,
+			BatchBytes:    wrConf.BatchBytes,
+			FlushInterval: time.Duration(wrConf.FlushInterval) * time.Millisecond,
+			Gzip:          wrConf.Gzip,
+			MaxRetries:    wrConf.MaxRetries,
+			Queue:         queue,
+		})
+	case writer.RING:
+		wr, err = writer.NewRingWriter(wrConf.Name, wrConf.Size)
+	default:
+		factory, ok := writer.Lookup(wrConf.Type)
+		if !ok {
+			return nil, errors.New("not valid writer type: " + wrConf.Type)
+		}
+		// the factory can't modify options kept in configuration
+		if wr, err = factory(copyOptions(wrConf.Options)); err == nil {
+			if wr == nil {
+				return nil, errors.New("writer factory returns nil, type: " + wrConf.Type)
+			}
+			wr.SetName(wrConf.Name)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &logWriter{
+		LogWriter:  wr,
+		encode:     enc,
+		level:      level,
+		filter:     filter,
+		belowLevel: wrConf.Type == writer.RING,
+		conf:       wrConf,
+	}, nil
+}
+
+// copyOptions returns a copy of options, nested values are shared
+func copyOptions(options map[string]interface{}) map[string]interface{} {
+	if options == nil {
+		return nil
+	}
+	c := make(map[string]interface{}, len(options))
+	for key, value := range options {
+		c[key] = value
+	}
+	return c
+}
+
+// queueOptions returns the queue options of the writer configured by wrConf
+func queueOptions(wrConf WriterConfig) (writer.QueueOptions, error) {
+	opts := writer.QueueOptions{
+		Size:     wrConf.QueueSize,
+		Overflow: writer.Overflow(wrConf.Overflow),
+		Level:    Warn,
+	}
+	if wrConf.OverflowLevel != "" {
+		lv, ok := parseLevel(wrConf.OverflowLevel)
+		if !ok {
+			return opts, errors.New("unkown overflow level: " + wrConf.OverflowLevel)
+		}
+		opts.Level = int(lv)
+	}
+	return opts, nil
+}
+
+func newFileWriter(wrConf WriterConfig, queue writer.QueueOptions) (writer.LogWriter, error) {
+	if wrConf.MaxSize < 0 || wrConf.MaxBackups < 0 || wrConf.MaxAge < 0 {
+		return nil, errors.New("rotation options can't be negative, writer: " + wrConf.Name)
+	}
+	if wrConf.BufferSize < 0 {
+		return nil, errors.New("buffer size can't be negative, writer: " + wrConf.Name)
+	}
+	return writer.NewFileWriterWithOptions(wrConf.Name, wrConf.File, writer.FileOptions{
+		MaxSize:       int64(wrConf.MaxSize) << 20,
+		MaxBackups:    wrConf.MaxBackups,
+		MaxAge:        time.Duration(wrConf.MaxAge) * 24 * time.Hour,
+		Link:          wrConf.Link,
+		Compress:      wrConf.Compress,
+		Queue:         queue,
+		BufferSize:    wrConf.BufferSize,
+		FlushInterval: time.Duration(wrConf.FlushInterval) * time.Millisecond,
+	})
+}
+
+// closeWriters closes writers in wrs which are not in keep.
+func closeWriters(wrs, keep map[string]*logWriter) {
+	for name, wr := range wrs {
+		if keep[name] != wr {
+			wr.Close()
 		}
-		writers[wrConf.Name] = wr
 	}
-	return nil
 }
 
-func verifyConf() error {
-	if len(conf.Loggers) == 0 {
-		conf.Loggers = append(conf.Loggers, logConf{
+// verifyConf verifies c and returns compiled logger patterns, the predefined
+// writers "STDOUT" and "STDERR" are added to wrs if they're used.
+func verifyConf(c *Config, wrs map[string]*logWriter) ([]*loggerPattern, error) {
+	if len(c.Loggers) == 0 {
+		c.Loggers = append(c.Loggers, LoggerConfig{
 			Pattern: "*",
 			Level:   LvNameDebug,
 			Writers: []string{"STDOUT"},
 		})
 	}
-	for _, logger := range conf.Loggers {
-		if err := verifyLogLevel(logger.Level); err != nil {
-			return err
+	// STDOUT is the default writer of loggers no writer is configured for
+	if err := addPredefinedWriter("STDOUT", wrs); err != nil {
+		return nil, err
+	}
+	ps := make([]*loggerPattern, 0, len(c.Loggers))
+	for _, logger := range c.Loggers {
+		p, err := compilePattern(logger.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, p)
+		if logger.Level != "" {
+			if err := verifyLogLevel(logger.Level); err != nil {
+				return nil, err
+			}
 		}
 		for _, writerName := range logger.Writers {
-			if wr := writers[writerName]; wr == nil {
-				switch writerName {
-				case "STDOUT", "STDERR":
-					writers[writerName], _ = writer.NewFileWriter(writerName, "")
-				default:
-					return errors.New("can't find log writer: " + writerName)
-				}
+			if err := addPredefinedWriter(writerName, wrs); err != nil {
+				return nil, err
 			}
 		}
 	}
+	// ring writers are linked to their targets after all checks, a reused
+	// ring writer mustn't be linked to a new target if c is invalid
+	for _, wr := range wrs {
+		if !wr.belowLevel {
+			continue
+		}
+		if err := addPredefinedWriter(wr.conf.Target, wrs); err != nil {
+			return nil, err
+		}
+		if wrs[wr.conf.Target].conf.Type == writer.RING {
+			return nil, errors.New("ring writer can't dump to ring writer: " + wr.conf.Target)
+		}
+	}
+	for _, wr := range wrs {
+		if wr.belowLevel {
+			target := wrs[wr.conf.Target]
+			target.Run()
+			writer.SetRingTarget(wr.LogWriter, target.LogWriter)
+		}
+	}
+	return ps, nil
+}
 
-	return nil
+// addPredefinedWriter adds the predefined writer "STDOUT" or "STDERR" to
+// wrs if name is one of them, an error is returned if name is neither a
+// predefined writer nor in wrs.
+func addPredefinedWriter(name string, wrs map[string]*logWriter) error {
+	if wrs[name] != nil {
+		return nil
+	}
+	switch name {
+	case "STDOUT", "STDERR":
+		// a writer redefined by the previous configuration isn't reused,
+		// its level, filter or format don't apply any more
+		if wr := writers[name]; wr != nil && !wr.closed && reflect.DeepEqual(wr.conf, WriterConfig{}) {
+			wrs[name] = wr
+		} else {
+			wr, _ := writer.NewFileWriter(name, "")
+			wrs[name] = &logWriter{LogWriter: wr, encode: encodeText}
+		}
+		return nil
+	default:
+		return errors.New("can't find log writer: " + name)
+	}
 }
 
 func verifyLogLevel(level string) error {
@@ -228,51 +636,177 @@ func verifyLogLevel(level string) error {
 // the logger path is the caller's package path
 func GetLogger(pkgInfo interface{}) Logger {
 	fullPath := reflect.TypeOf(pkgInfo).PkgPath()
-	abbrPath := makeAbbrPath(fullPath)
-	if logger, ok := loggers[fullPath]; ok {
+	if logger := lookupLogger(fullPath); logger != nil {
 		return logger
 	}
-	return doGetLogger(fullPath, abbrPath)
+	return doGetLogger(fullPath, makeAbbrPath(fullPath))
 }
 
 // GetLoggerWithPath returns a logger with a specific path, recommands to use
 // GetLogger instead of GetLoggerWithPath, unless the package path includes
 // string 'src'.
 func GetLoggerWithPath(path string) Logger {
+	if logger := lookupLogger(path); logger != nil {
+		return logger
+	}
 	return doGetLogger(path, makeAbbrPath(path))
 }
 
+// NewLogger creates a logger of path writing only to wr, records are
+// formatted by format. The logger isn't managed by configuration, its level
+// is DEBUG until SetLevel is called. wr is run by NewLogger, and it's owned
+// by the caller.
+func NewLogger(path, format string, wr writer.LogWriter) (Logger, error) {
+	enc, err := getEncoder(format)
+	if err != nil {
+		return nil, err
+	}
+	wr.Run()
+	logger := &loggerImpl{
+		loggerCore: &loggerCore{},
+		fullPath:   path,
+		abbrPath:   makeAbbrPath(path),
+	}
+	logger.setWriters([]*logWriter{{LogWriter: wr, encode: enc}})
+	logger.setLevel(Debug)
+	return logger, nil
+}
+
+// lookupLogger returns the created logger of fullPath, or nil
+func lookupLogger(fullPath string) *loggerImpl {
+	mu.RLock()
+	defer mu.RUnlock()
+	return loggers[fullPath]
+}
+
 // Close flushes all data to files closes, this func should be called
-// before application exits.
+// before application exits. Closed writers aren't reused by reloading, so
+// Reload or Configure after Close creates new writers.
 func Close() {
+	mu.Lock()
+	defer mu.Unlock()
 	for _, wr := range writers {
 		wr.Close()
+		wr.closed = true
 	}
 }
 
+// Flush writes all records logged before it by buffered writers, e.g. a
+// "FILE" writer with bufferSize, or a "HTTP" writer.
+func Flush() {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, wr := range writers {
+		if f, ok := wr.LogWriter.(writer.Flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
+// Dropped returns the count of lines dropped by the writer named name, by
+// its overflow policy, or by the writer itself, e.g. a "TCP" writer drops the
+// oldest lines if its backlog is full. It's 0 if the writer doesn't exist.
+func Dropped(name string) uint64 {
+	mu.RLock()
+	wr := writers[name]
+	mu.RUnlock()
+	if wr == nil {
+		return 0
+	}
+	if dc, ok := wr.LogWriter.(writer.DropCounter); ok {
+		return dc.Dropped()
+	}
+	return 0
+}
+
 func doGetLogger(fullPath, abbrPath string) Logger {
-	for _, logConf := range conf.Loggers {
-		if isWildMatch(logConf.Pattern, fullPath) {
-			var logger Logger
-			logger = loggers[fullPath]
-			if logger == nil {
-				logger = &loggerImpl{
-					fullPath: fullPath,
-					abbrPath: abbrPath,
-					writers:  getLogWriters(logConf.Writers),
-				}
-				logger.SetLevel(logConf.Level)
-				loggers[fullPath] = logger
+	mu.Lock()
+	defer mu.Unlock()
+	logger := loggers[fullPath]
+	if logger == nil {
+		logger = &loggerImpl{
+			loggerCore: &loggerCore{},
+			fullPath:   fullPath,
+			abbrPath:   abbrPath,
+		}
+		configLogger(logger)
+		loggers[fullPath] = logger
+	}
+	return logger
+}
+
+// configLogger applies the configuration resolved for the path of l to l.
+func configLogger(l *loggerImpl) {
+	level, writerNames := resolveLogger(l.fullPath)
+	lv, _ := parseLevel(level)
+	l.setWriters(appendAttached(getLogWriters(writerNames), l.fullPath))
+	l.setLevel(lv)
+}
+
+// resolveLogger resolves level and writers of a logger path. Logger
+// configurations matching path are applied from the least specific one to
+// the most specific one, level and writers not set are inherited. The level
+// is DEBUG and the writer is STDOUT if none is configured.
+func resolveLogger(path string) (level string, writerNames []string) {
+	type match struct {
+		conf        *LoggerConfig
+		index       int
+		specificity int
+	}
+	var matches []match
+	for i, p := range patterns {
+		if p.match(path) {
+			matches = append(matches, match{&conf.Loggers[i], i, p.specificity})
+		}
+	}
+	// configurations of the same specificity are applied in reverse order,
+	// so the first one in configuration wins
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].specificity != matches[j].specificity {
+			return matches[i].specificity < matches[j].specificity
+		}
+		return matches[i].index > matches[j].index
+	})
+	level = LvNameDebug
+	for _, m := range matches {
+		if m.conf.Level != "" {
+			level = m.conf.Level
+		}
+		if len(m.conf.Writers) == 0 {
+			continue
+		}
+		if m.conf.Additive {
+			writerNames = appendWriterNames(writerNames, m.conf.Writers)
+		} else {
+			writerNames = appendWriterNames(nil, m.conf.Writers)
+		}
+	}
+	if len(writerNames) == 0 {
+		writerNames = []string{"STDOUT"}
+	}
+	return level, writerNames
+}
+
+// appendWriterNames appends names not in dst to dst.
+func appendWriterNames(dst, names []string) []string {
+	for _, name := range names {
+		found := false
+		for _, n := range dst {
+			if n == name {
+				found = true
+				break
 			}
-			return logger
+		}
+		if !found {
+			dst = append(dst, name)
 		}
 	}
-	panic("should not arrive here!")
+	return dst
 }
 
-func getLogWriters(writerNames []string) []writer.LogWriter {
+func getLogWriters(writerNames []string) []*logWriter {
 	size := len(writerNames)
-	wrs := make([]writer.LogWriter, 0, size)
+	wrs := make([]*logWriter, 0, size)
 	for _, wrConf := range writerNames {
 		wr := writers[wrConf]
 		wr.Run()
@@ -293,7 +827,10 @@ func makeAbbrPath(fullPath string) (abbrPath string) {
 	count := len(dirs)
 	for i, dir := range dirs {
 		if i != count-1 {
-			abbrPath += dir[0:1]
+			// empty segments, e.g. of "/var/app", are kept empty
+			if dir != "" {
+				abbrPath += dir[0:1]
+			}
 			abbrPath += "/"
 		} else {
 			abbrPath += dir
@@ -301,14 +838,3 @@ func makeAbbrPath(fullPath string) (abbrPath string) {
 	}
 	return abbrPath
 }
-
-func isWildMatch(pattern, str string) bool {
-	if pattern == "*" {
-		return true
-	}
-	patternLen := len(pattern)
-	if pattern[patternLen-1] == '*' {
-		return strings.HasPrefix(str, pattern[:patternLen-1])
-	}
-	return pattern == str
-}
@@ -1,79 +1,24 @@
 package slog
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	stdslog "log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
 	"time"
-)
-
-type computer struct {
-	name string
-	core int
-}
-
-func testAll(level string, prefix string) {
-	type slogPkgInfo struct{}
-	logger := GetLogger(slogPkgInfo{})
-	logger.SetLevel(level)
-	testComputer := computer{"mycomputer", 4}
-	//fmt.Printf("logger: %#v\n", logger)
-
-	format := "my computer is %s, core num is %v"
-
-	time.Sleep(100 * time.Millisecond)
-
-	logger.Debug("my computer is ", testComputer.name, ", core num is ", testComputer.core)
-	logger.Debugf(format, testComputer.name, testComputer.core)
-	logger.Info("my computer is ", testComputer.name, ", core num is ", testComputer.core)
-	logger.Infof(format, testComputer.name, testComputer.core)
-
-	logger.Notice("my computer is ", testComputer.name, ", core num is ", testComputer.core)
-	logger.Noticef(format, testComputer.name, testComputer.core)
-
-	logger.Warn("my computer is ", testComputer.name, ", core num is ", testComputer.core)
-	logger.Warnf(format, testComputer.name, testComputer.core)
-
-	logger.Error("my computer is ", testComputer.name, ", core num is ", testComputer.core)
-	logger.Errorf(format, testComputer.name, testComputer.core)
-
-	/*logger.Fatal("my computer is ", testComputer.name, ", core num is ", testComputer.core)*/
-	/*logger.Fatalf(format, testComputer.name, testComputer.core)*/
-}
-
-func TestDebug(t *testing.T) {
-	fmt.Println("======================DEBUG======================")
-	testAll("DEBUG", "")
-}
 
-func TestInfo(t *testing.T) {
-	time.Sleep(100 * time.Millisecond)
-	fmt.Println("======================INFO======================")
-	testAll("INFO", "")
-}
-
-func TestNotice(t *testing.T) {
-	time.Sleep(100 * time.Millisecond)
-	fmt.Println("======================NOTICE======================")
-	testAll("NOTICE", "")
-}
-
-func TestWarn(t *testing.T) {
-	time.Sleep(100 * time.Millisecond)
-	fmt.Println("======================WARN======================")
-	testAll("WARN", "")
-}
-
-func TestError(t *testing.T) {
-	time.Sleep(100 * time.Millisecond)
-	fmt.Println("======================ERROR======================")
-	testAll("ERROR", "")
-}
-
-func TestFatal(t *testing.T) {
-	time.Sleep(100 * time.Millisecond)
-	fmt.Println("======================FATAL======================")
-	testAll("FATAL", "")
-}
+	"github.com/kuun/slog/buffer"
+	"github.com/kuun/slog/writer"
+)
 
 func TestGetLogPath(t *testing.T) {
 	fullPath := getLogPath()
@@ -120,8 +65,827 @@ func TestMakeAbbrPath(t *testing.T) {
 	if abbrPath != "g/k/s/test" {
 		t.Errorf("make abbravitated path error, abbr path: %s", abbrPath)
 	}
+	for path, expect := range map[string]string{"/var/app": "/v/app", "a//b": "a//b", "app/": "a/"} {
+		if abbrPath := makeAbbrPath(path); abbrPath != expect {
+			t.Errorf("make abbravitated path of %s error, abbr path: %s", path, abbrPath)
+		}
+	}
 }
 
 func TestClose(t *testing.T) {
+	type slogPkgInfo struct{}
+	logger := GetLogger(slogPkgInfo{})
+	defer Configure(Config{})
+
+	c := Config{
+		Writers: []WriterConfig{{Name: "file", File: filepath.Join(t.TempDir(), "app.log"), BufferSize: 1024}},
+		Loggers: []LoggerConfig{{Pattern: "*", Level: LvNameDebug, Writers: []string{"file", "STDOUT"}}},
+	}
+	if err := Configure(c); err != nil {
+		t.Fatalf("configure error: %s", err)
+	}
 	Close()
+	// writers closed by Close are created again by the same configuration
+	if err := Configure(c); err != nil {
+		t.Fatalf("configure error: %s", err)
+	}
+	logger.Info("after close")
+	Flush()
+	data, err := os.ReadFile(c.Writers[0].File)
+	if err != nil || !strings.Contains(string(data), "after close") {
+		t.Errorf("record after close isn't written: %q, %v", data, err)
+	}
+	for name, wr := range writers {
+		if wr.closed {
+			t.Errorf("writer %s is closed", name)
+		}
+	}
+}
+
+// fieldError is an error whose methods panic on a nil pointer
+type fieldError struct {
+	msg string
+}
+
+func (e *fieldError) Error() string { return e.msg }
+
+func TestFields(t *testing.T) {
+	fields := makeFields([]interface{}{"id", 7, F("user", "bob smith"), 3, "dangling"})
+	expects := []Field{
+		{"id", 7},
+		{"user", "bob smith"},
+		{badKey, 3},
+		{"dangling", missingValue},
+	}
+	if len(fields) != len(expects) {
+		t.Fatalf("make fields error, fields: %v", fields)
+	}
+	for i, field := range fields {
+		if field != expects[i] {
+			t.Errorf("make fields error, field: %v, expect: %v", field, expects[i])
+		}
+	}
+
+	buf := buffer.GetBuffer()
+	writeFields(buf, fields[:2])
+	var nilErr *fieldError
+	writeFields(buf, []Field{{"err", errors.New("a=b")}, {"empty", ""}, {"nil", nilErr}})
+	expect := ` id=7 user="bob smith" err="a=b" empty="" nil=<nil>`
+	if buf.String() != expect {
+		t.Errorf("write fields error, output: %s, expect: %s", buf.String(), expect)
+	}
+}
+
+func TestWith(t *testing.T) {
+	type slogPkgInfo struct{}
+	logger := GetLogger(slogPkgInfo{}).With("request", 1)
+	a := logger.With("shard", "a").(*loggerImpl)
+	b := logger.With("shard", "b").(*loggerImpl)
+	if len(a.fields) != 2 || a.fields[1].Value != "a" {
+		t.Errorf("child logger fields error: %v", a.fields)
+	}
+	if len(b.fields) != 2 || b.fields[1].Value != "b" {
+		t.Errorf("child logger fields error: %v", b.fields)
+	}
+	b.Infow("with fields", "user", 42)
+}
+
+// fieldStringer is a fmt.Stringer whose methods panic on a nil pointer
+type fieldStringer struct {
+	name string
+}
+
+func (s *fieldStringer) String() string { return s.name }
+
+func TestEncodeJSON(t *testing.T) {
+	l := &loggerImpl{fullPath: "github.com/kuun/slog", abbrPath: "g/k/slog"}
+	r := record{
+		time:   time.Now(),
+		level:  Notice,
+		logger: l,
+		file:   "slog_test.go",
+		line:   10,
+		msg:    "quote \" and\nnew line \xff",
+		fields: []Field{{"user", 42}, {"err", errors.New("oops")}, {"cost", time.Second}, {"nilErr", (*fieldError)(nil)}, {"nilStringer", (*fieldStringer)(nil)}},
+	}
+	buf := encodeJSON(&r)
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatalf("encode json error: %s, output: %s", err, buf.String())
+	}
+	if m["level"] != LvNameNotice || m["logger"] != l.fullPath || m["line"] != float64(10) {
+		t.Errorf("encode json error, output: %s", buf.String())
+	}
+	if m["msg"] != "quote \" and\nnew line �" {
+		t.Errorf("encode json message error: %q", m["msg"])
+	}
+	fields, _ := m["fields"].(map[string]interface{})
+	if fields["user"] != float64(42) || fields["err"] != "oops" || fields["cost"] != "1s" || fields["nilErr"] != nil || fields["nilStringer"] != nil {
+		t.Errorf("encode json fields error, output: %s", buf.String())
+	}
+}
+
+func TestReload(t *testing.T) {
+	type slogPkgInfo struct{}
+	logger := GetLogger(slogPkgInfo{}).(*loggerImpl)
+	child := logger.With("reload", true)
+
+	logFile := filepath.Join(t.TempDir(), "reload.log")
+	confFile := filepath.Join(t.TempDir(), "slog.json")
+	confData := `{
+		"writers": [{"name": "file", "file": "` + logFile + `", "format": "json"}],
+		"loggers": [{"pattern": "*", "level": "WARN", "writers": ["file"]}]
+	}`
+	if err := os.WriteFile(confFile, []byte(confData), 0666); err != nil {
+		t.Fatalf("write config file error: %s", err)
+	}
+	t.Setenv("SLOG_CONF_FILE", confFile)
+	if err := Reload(); err != nil {
+		t.Fatalf("reload error: %s", err)
+	}
+	if child.GetLevel() != LvNameWarn || len(*logger.writers.Load()) != 1 || (*logger.writers.Load())[0].GetName() != "file" {
+		t.Errorf("reload config error, level: %s, writers: %v", child.GetLevel(), *logger.writers.Load())
+	}
+	child.Info("filtered")
+	child.Warn("written")
+
+	// invalid configuration is not applied
+	if err := os.WriteFile(confFile, []byte(`{"loggers": [{"pattern": "*", "level": "NONE"}]}`), 0666); err != nil {
+		t.Fatalf("write config file error: %s", err)
+	}
+	if err := Reload(); err == nil || child.GetLevel() != LvNameWarn {
+		t.Errorf("invalid config is applied, error: %v", err)
+	}
+
+	// restore the default configuration, file writer is closed
+	os.Setenv("SLOG_CONF_FILE", "")
+	if err := Reload(); err != nil {
+		t.Fatalf("reload error: %s", err)
+	}
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("read log file error: %s", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 1 ||
+		!strings.Contains(lines[0], `"msg":"written","fields":{"reload":true}`) {
+		t.Errorf("log file content error: %s", data)
+	}
+	if logger.GetLevel() != LvNameDebug || (*logger.writers.Load())[0].GetName() != "STDOUT" {
+		t.Errorf("restore config error, level: %s", logger.GetLevel())
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	type slogPkgInfo struct{}
+	logger := GetLogger(slogPkgInfo{})
+	defer Configure(Config{})
+
+	err := Configure(Config{
+		Writers: []WriterConfig{{Name: "file", File: filepath.Join(t.TempDir(), "app.log")}},
+		Loggers: []LoggerConfig{{Pattern: "*", Level: LvNameError, Writers: []string{"file", "STDERR"}}},
+	})
+	if err != nil {
+		t.Fatalf("configure error: %s", err)
+	}
+	if logger.GetLevel() != LvNameError {
+		t.Errorf("configure level error: %s", logger.GetLevel())
+	}
+
+	invalids := []Config{
+		{Writers: []WriterConfig{{Name: "file", Type: "NONE"}}},
+		{Writers: []WriterConfig{{Name: "file", Format: "xml"}}},
+		{Writers: []WriterConfig{{Name: "file", File: os.DevNull, Overflow: "drop"}}},
+		{Writers: []WriterConfig{{Name: "file", File: os.DevNull, Overflow: "drop-below-level", OverflowLevel: "TRACE"}}},
+		{Writers: []WriterConfig{{Name: "syslog", Type: "SYSLOG", Network: "udp", Address: "127.0.0.1:514", Facility: "none"}}},
+		{Writers: []WriterConfig{{Name: "a", File: os.DevNull}, {Name: "a", File: os.DevNull}}},
+		{Loggers: []LoggerConfig{{Pattern: "*", Level: LvNameInfo, Writers: []string{"none"}}}},
+		{Loggers: []LoggerConfig{{Pattern: "*", Level: "VERBOSE"}}},
+	}
+	for _, cfg := range invalids {
+		if err := Configure(cfg); err == nil {
+			t.Errorf("invalid config is applied: %v", cfg)
+		}
+	}
+	if logger.GetLevel() != LvNameError {
+		t.Errorf("invalid config is applied, level: %s", logger.GetLevel())
+	}
+}
+
+func TestConfigureGoroutines(t *testing.T) {
+	type slogPkgInfo struct{}
+	// writers run when they're used by a logger
+	GetLogger(slogPkgInfo{})
+	defer Configure(Config{})
+
+	dir := t.TempDir()
+	before := runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		err := Configure(Config{
+			Writers: []WriterConfig{
+				{Name: "file", File: filepath.Join(dir, fmt.Sprintf("app-%d.log", i)), BufferSize: 1024, MaxAge: 1},
+				{Name: "tcp", Type: writer.TCP, Address: fmt.Sprintf("127.0.0.1:%d", i+1)},
+				{Name: "http", Type: writer.HTTP, URL: fmt.Sprintf("http://127.0.0.1:1/logs/%d", i)},
+			},
+			Loggers: []LoggerConfig{{Pattern: "*", Level: LvNameDebug, Writers: []string{"file", "tcp", "http"}}},
+		})
+		if err != nil {
+			t.Fatalf("configure error: %s", err)
+		}
+	}
+	Configure(Config{})
+	// writing go routines of closed writers exit
+	after := runtime.NumGoroutine()
+	for i := 0; i < 100 && after > before+2; i++ {
+		time.Sleep(10 * time.Millisecond)
+		after = runtime.NumGoroutine()
+	}
+	if after > before+2 {
+		t.Errorf("go routines leak, %d before configuring, %d after", before, after)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	type slogPkgInfo struct{}
+	logger := GetLogger(slogPkgInfo{})
+	defer Configure(Config{})
+
+	fileName := filepath.Join(t.TempDir(), "app.log")
+	err := Configure(Config{
+		Writers: []WriterConfig{{Name: "file", File: fileName, BufferSize: 4096, FlushInterval: 3600000}},
+		Loggers: []LoggerConfig{{Pattern: "*", Level: LvNameDebug, Writers: []string{"file"}}},
+	})
+	if err != nil {
+		t.Fatalf("configure error: %s", err)
+	}
+	logger.Info("buffered")
+	Flush()
+	data, err := os.ReadFile(fileName)
+	if err != nil || !strings.Contains(string(data), "buffered") {
+		t.Errorf("record isn't flushed: %q, %v", data, err)
+	}
+}
+
+func TestWriterFilter(t *testing.T) {
+	type slogPkgInfo struct{}
+	logger := GetLogger(slogPkgInfo{})
+	defer Configure(Config{})
+
+	dir := t.TempDir()
+	err := Configure(Config{
+		Writers: []WriterConfig{
+			{Name: "warn", File: filepath.Join(dir, "warn.log"), Level: LvNameWarn},
+			{Name: "slow", File: filepath.Join(dir, "slow.log"), Filter: "path^=github.com/kuun/ && msg~=slow && user=42"},
+		},
+		Loggers: []LoggerConfig{{Pattern: "*", Level: LvNameDebug, Writers: []string{"warn", "slow"}}},
+	})
+	if err != nil {
+		t.Fatalf("configure error: %s", err)
+	}
+	logger.Infow("slow query", "user", 42)
+	logger.Infow("slow query", "user", 7)
+	logger.Warnw("fast query", "user", 42)
+	Flush()
+
+	expects := map[string][]string{
+		"warn.log": {"fast query user=42"},
+		"slow.log": {"slow query user=42"},
+	}
+	for name, lines := range expects {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("read file error: %s", err)
+		}
+		content := strings.TrimSpace(string(data))
+		records := strings.Split(content, "\n")
+		if len(records) != len(lines) || !strings.HasSuffix(records[0], lines[0]) {
+			t.Errorf("%s content: %q, expect: %q", name, content, lines)
+		}
+	}
+
+	for _, expr := range []string{"path", "=42", "path~=a"} {
+		if _, err := parseFilter(expr); err == nil {
+			t.Errorf("invalid filter is parsed: %q", expr)
+		}
+	}
+}
+
+func TestRedefinePredefinedWriter(t *testing.T) {
+	type slogPkgInfo struct{}
+	logger := GetLogger(slogPkgInfo{}).(*loggerImpl)
+	defer Configure(Config{})
+
+	err := Configure(Config{Writers: []WriterConfig{{Name: "STDOUT", Level: LvNameError}}})
+	if err != nil {
+		t.Fatalf("configure error: %s", err)
+	}
+	if wrs := *logger.writers.Load(); len(wrs) != 1 || wrs[0].level != Error {
+		t.Fatalf("redefined STDOUT: %+v", wrs)
+	}
+	// the default configuration resets STDOUT
+	if err := Configure(Config{}); err != nil {
+		t.Fatalf("configure error: %s", err)
+	}
+	if wrs := *logger.writers.Load(); len(wrs) != 1 || wrs[0].level != Debug || wrs[0].conf.Name != "" {
+		t.Errorf("STDOUT after reset: %+v", wrs)
+	}
+}
+
+func TestRingWriter(t *testing.T) {
+	type slogPkgInfo struct{}
+	logger := GetLogger(slogPkgInfo{})
+	defer Configure(Config{})
+
+	fileName := filepath.Join(t.TempDir(), "dump.log")
+	err := Configure(Config{
+		Writers: []WriterConfig{
+			{Name: "ring", Type: "RING", Size: 10, Target: "dump"},
+			{Name: "dump", File: fileName},
+		},
+		Loggers: []LoggerConfig{{Pattern: "*", Level: LvNameWarn, Writers: []string{"ring"}}},
+	})
+	if err != nil {
+		t.Fatalf("configure error: %s", err)
+	}
+	if logger.IsDebugEnabled() {
+		t.Error("debug is enabled by ring writer")
+	}
+	logger.Debug("debug context")
+	logger.Info("info context")
+	Flush()
+	if data, _ := os.ReadFile(fileName); len(data) != 0 {
+		t.Errorf("lines are dumped before error: %q", data)
+	}
+	logger.Error("boom")
+	Flush()
+	data, _ := os.ReadFile(fileName)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[0], "debug context") || !strings.HasSuffix(lines[2], "boom") {
+		t.Errorf("dumped lines: %q", lines)
+	}
+
+	invalids := []Config{
+		{Writers: []WriterConfig{{Name: "ring", Type: "RING"}}},
+		{Writers: []WriterConfig{{Name: "ring", Type: "RING", Target: "none"}}},
+		{Writers: []WriterConfig{{Name: "ring", Type: "RING", Target: "ring"}}},
+	}
+	for _, cfg := range invalids {
+		if err := Configure(cfg); err == nil {
+			t.Errorf("invalid config is applied: %v", cfg)
+		}
+	}
+}
+
+// memWriter keeps lines in memory, it's registered as type "MEMORY"
+type memWriter struct {
+	name   string
+	prefix string
+	mu     sync.Mutex
+	lines  []string
+}
+
+func (w *memWriter) SetName(name string)  { w.name = name }
+func (w *memWriter) GetName() string      { return w.name }
+func (w *memWriter) GetType() writer.Type { return "MEMORY" }
+func (w *memWriter) Run()                 {}
+func (w *memWriter) Close()               {}
+
+func (w *memWriter) Write(buff *buffer.Buffer) {
+	w.mu.Lock()
+	w.lines = append(w.lines, w.prefix+buff.String())
+	w.mu.Unlock()
+	buffer.PutBuffer(buff)
+}
+
+// createdMemWriter is the last writer created by newMemWriter
+var createdMemWriter *memWriter
+
+func newMemWriter(conf map[string]interface{}) (writer.LogWriter, error) {
+	prefix, ok := conf["prefix"].(string)
+	if !ok {
+		return nil, errors.New("prefix is required")
+	}
+	createdMemWriter = &memWriter{prefix: prefix}
+	return createdMemWriter, nil
+}
+
+// the registry is global, the type is registered once however many times
+// tests run by -count
+func init() {
+	writer.Register("MEMORY", newMemWriter)
+}
+
+func TestRegisterWriter(t *testing.T) {
+	type slogPkgInfo struct{}
+	logger := GetLogger(slogPkgInfo{})
+	defer Configure(Config{})
+
+	createdMemWriter = nil
+	var c Config
+	err := json.Unmarshal([]byte(`{
+		"writers": [{"name": "mem", "type": "MEMORY", "format": "json", "options": {"prefix": "> "}}],
+		"loggers": [{"pattern": "*", "level": "INFO", "writers": ["mem"]}]
+	}`), &c)
+	if err != nil {
+		t.Fatalf("parse config error: %s", err)
+	}
+	if err = Configure(c); err != nil {
+		t.Fatalf("configure error: %s", err)
+	}
+	logger.Info("hello")
+	created := createdMemWriter
+	if created == nil || created.GetName() != "mem" {
+		t.Fatalf("registered writer isn't created: %+v", created)
+	}
+	if len(created.lines) != 1 || !strings.HasPrefix(created.lines[0], `> {"ts":`) {
+		t.Errorf("registered writer lines: %q", created.lines)
+	}
+
+	err = Configure(Config{Writers: []WriterConfig{{Name: "mem", Type: "MEMORY"}}})
+	if err == nil || !strings.Contains(err.Error(), "prefix is required") {
+		t.Errorf("error of factory isn't returned: %v", err)
+	}
+}
+
+func TestInitConf(t *testing.T) {
+	type slogPkgInfo struct{}
+	logger := GetLogger(slogPkgInfo{}).(*loggerImpl)
+	defer Configure(Config{})
+	defer func(err error) { initErr = err }(initErr)
+
+	confFile := filepath.Join(t.TempDir(), "slog.json")
+	if err := os.WriteFile(confFile, []byte(`{"loggers": [`), 0666); err != nil {
+		t.Fatalf("write config file error: %s", err)
+	}
+	t.Setenv("SLOG_CONF_FILE", confFile)
+	t.Setenv("SLOG_STRICT", "false")
+	logger.SetLevel(LvNameError)
+	err := initConf()
+	if err == nil {
+		t.Errorf("invalid config file should return error")
+	}
+	if logger.GetLevel() != LvNameDebug || (*logger.writers.Load())[0].GetName() != "STDOUT" {
+		t.Errorf("default config should be used, level: %s", logger.GetLevel())
+	}
+	loadInitConf()
+	if InitError() == nil || InitError().Error() != err.Error() {
+		t.Errorf("init error: %v, expect: %v", InitError(), err)
+	}
+
+	// a valid config file
+	if err := os.WriteFile(confFile, []byte(`{}`), 0666); err != nil {
+		t.Fatalf("write config file error: %s", err)
+	}
+	loadInitConf()
+	if InitError() != nil {
+		t.Errorf("init error of valid config file: %s", InitError())
+	}
+}
+
+// TestInitConfStrict runs the test binary with an invalid config file in
+// strict mode, it should exit at initialization.
+func TestInitConfStrict(t *testing.T) {
+	if os.Getenv("SLOG_TEST_STRICT") != "" {
+		// the application isn't exited by initialization
+		return
+	}
+	confFile := filepath.Join(t.TempDir(), "slog.json")
+	if err := os.WriteFile(confFile, []byte(`{"loggers": [`), 0666); err != nil {
+		t.Fatalf("write config file error: %s", err)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestInitConfStrict$")
+	cmd.Env = append(os.Environ(), "SLOG_TEST_STRICT=1", "SLOG_CONF_FILE="+confFile, "SLOG_STRICT=true")
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Fatalf("application should exit with 1, error: %v, output: %s", err, out)
+	}
+	if !strings.HasPrefix(string(out), "slog ") || strings.Contains(string(out), "default configuration") {
+		t.Errorf("output in strict mode: %s", out)
+	}
+}
+
+// TestFatalFlush runs the test binary to log a FATAL record to a buffered
+// file, the record should be written before the application exits.
+func TestFatalFlush(t *testing.T) {
+	if logFile := os.Getenv("SLOG_TEST_FATAL"); logFile != "" {
+		type slogPkgInfo struct{}
+		logger := GetLogger(slogPkgInfo{})
+		err := Configure(Config{
+			Writers: []WriterConfig{{Name: "file", File: logFile, BufferSize: 4096, FlushInterval: 3600000}},
+			Loggers: []LoggerConfig{{Pattern: "*", Level: LvNameDebug, Writers: []string{"file"}}},
+		})
+		if err != nil {
+			t.Fatalf("configure error: %s", err)
+		}
+		logger.Info("before fatal")
+		logger.Fatalf("fatal %d", 1)
+		return
+	}
+	logFile := filepath.Join(t.TempDir(), "app.log")
+	cmd := exec.Command(os.Args[0], "-test.run=^TestFatalFlush$")
+	cmd.Env = append(os.Environ(), "SLOG_TEST_FATAL="+logFile)
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Fatalf("application should exit with 1, error: %v, output: %s", err, out)
+	}
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("read log file error: %s", err)
+	}
+	if !strings.Contains(string(data), "] before fatal") || !strings.Contains(string(data), "] fatal 1") {
+		t.Errorf("log file content: %q", data)
+	}
+}
+
+func TestResolveLogger(t *testing.T) {
+	defer Configure(Config{})
+	err := Configure(Config{
+		Writers: []WriterConfig{{Name: "file", File: filepath.Join(t.TempDir(), "app.log")}},
+		Loggers: []LoggerConfig{
+			{Pattern: "*", Level: LvNameInfo, Writers: []string{"STDOUT"}},
+			{Pattern: "github.com/org/svc", Writers: []string{"STDERR"}, Additive: true},
+			{Pattern: "github.com/org/*", Level: LvNameWarn, Writers: []string{"file"}},
+			{Pattern: "github.com/org/svc/db", Level: LvNameError},
+		},
+	})
+	if err != nil {
+		t.Fatalf("configure error: %s", err)
+	}
+	tests := []struct {
+		path    string
+		level   string
+		writers string
+	}{
+		{"github.com/other", LvNameInfo, "STDOUT"},
+		{"github.com/org/web", LvNameWarn, "file"},
+		{"github.com/org/svc", LvNameWarn, "file,STDERR"},
+		{"github.com/org/svc/api", LvNameWarn, "file,STDERR"},
+		{"github.com/org/svc/db", LvNameError, "file,STDERR"},
+	}
+	for _, test := range tests {
+		level, writerNames := resolveLogger(test.path)
+		if level != test.level || strings.Join(writerNames, ",") != test.writers {
+			t.Errorf("resolve logger %s error, level: %s, writers: %v", test.path, level, writerNames)
+		}
+	}
+
+	if err := Configure(Config{Loggers: []LoggerConfig{{Pattern: "github.com/org", Level: LvNameWarn}}}); err != nil {
+		t.Fatalf("configure error: %s", err)
+	}
+	if level, writerNames := resolveLogger("github.com/other"); level != LvNameDebug || writerNames[0] != "STDOUT" {
+		t.Errorf("default logger config error, level: %s, writers: %v", level, writerNames)
+	}
+}
+
+func TestLoggerPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"*", "github.com/kuun/slog", true},
+		{"github.com/kuun/*", "github.com/kuun/slog/demo", true},
+		{"*pkga", "github.com/kuun/slog/demo/pkga", true},
+		{"*/internal/*", "github.com/org/svc/internal/db", true},
+		{"*/internal/*", "github.com/org/svc/db", false},
+		{"github.com/org/*/db", "github.com/org/svc/db", true},
+		{"github.com/org/*/db", "github.com/org/svc/store/db", false},
+		{"github.com/org/**/db", "github.com/org/db", true},
+		{"github.com/org/**/db", "github.com/org/svc/store/db", true},
+		{"github.com/org/**/db", "github.com/org/svc/dbx", false},
+		{"github.com/org/svc?", "github.com/org/svc2", true},
+		{"github.com/org/svc", "github.com/org/svc/db", true},
+		{"github.com/org/svc", "github.com/org/svcx", false},
+		{"regex:github\\.com/org/(svc|web)", "github.com/org/web", true},
+		{"regex:github\\.com/org/(svc|web)", "github.com/org/web/api", false},
+	}
+	for _, test := range tests {
+		p, err := compilePattern(test.pattern)
+		if err != nil {
+			t.Errorf("compile pattern %s error: %s", test.pattern, err)
+			continue
+		}
+		if p.match(test.path) != test.match {
+			t.Errorf("pattern %s matches %s: %v, expect: %v", test.pattern, test.path, !test.match, test.match)
+		}
+	}
+
+	for _, pattern := range []string{"", "regex:(a"} {
+		if _, err := compilePattern(pattern); err == nil {
+			t.Errorf("invalid pattern %q is compiled", pattern)
+		}
+		if err := Configure(Config{Loggers: []LoggerConfig{{Pattern: pattern, Level: LvNameInfo}}}); err == nil {
+			t.Errorf("invalid pattern %q is configured", pattern)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	type slogPkgInfo struct{}
+	logger := GetLogger(slogPkgInfo{}).(*loggerImpl)
+	defer Configure(Config{})
+	logFile := filepath.Join(t.TempDir(), "app.log")
+	err := Configure(Config{
+		Writers: []WriterConfig{{Name: "file", File: logFile, Format: FormatJSON}},
+		Loggers: []LoggerConfig{
+			{Pattern: "*", Level: LvNameNotice, Writers: []string{"file"}},
+			{Pattern: "github.com/org/db", Level: LvNameError},
+		},
+	})
+	if err != nil {
+		t.Fatalf("configure error: %s", err)
+	}
+
+	std := stdslog.New(NewHandler(&HandlerOptions{LoggerKey: "logger"}))
+	std.Info("filtered")
+	std.Log(context.Background(), StdLevelNotice, "notice", "user", 42)
+	std.WithGroup("req").With("id", 7).Warn("grouped", stdslog.Group("db", "rows", 3))
+	std.With("logger", "github.com/org/db").Warn("filtered by path")
+	std.Error("by path", "logger", "github.com/org/db")
+	// paths with empty segments
+	std.Error("absolute path", "logger", "/var/app")
+	std.With("logger", "a//b").Error("empty segment")
+	if !std.Enabled(context.Background(), StdLevelNotice) || std.Enabled(context.Background(), stdslog.LevelInfo) {
+		t.Errorf("handler enabled error")
+	}
+	Close()
+
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("read log file error: %s", err)
+	}
+	expects := []string{
+		`"level":"NOTICE","logger":"` + logger.fullPath + `","file":"slog_test.go"`,
+		`"msg":"notice","fields":{"user":42}`,
+		`"msg":"grouped","fields":{"req.id":7,"req.db.rows":3}`,
+		`"level":"ERROR","logger":"github.com/org/db"`,
+		`"logger":"/var/app","file":"slog_test.go"`,
+		`"logger":"a//b","file":"slog_test.go"`,
+	}
+	for _, expect := range expects {
+		if !strings.Contains(string(data), expect) {
+			t.Errorf("log file should contain %s, content: %s", expect, data)
+		}
+	}
+	if strings.Contains(string(data), "filtered") {
+		t.Errorf("filtered record is written, content: %s", data)
+	}
+}
+
+func TestRedirectStdLog(t *testing.T) {
+	defer Configure(Config{})
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+	}()
+	logFile := filepath.Join(t.TempDir(), "app.log")
+	err := Configure(Config{
+		Writers: []WriterConfig{{Name: "file", File: logFile, Format: FormatJSON}},
+		Loggers: []LoggerConfig{
+			{Pattern: "*", Level: LvNameInfo, Writers: []string{"file"}},
+			{Pattern: "stdlog/debug", Level: LvNameWarn},
+		},
+	})
+	if err != nil {
+		t.Fatalf("configure error: %s", err)
+	}
+
+	if err := RedirectStdLog("stdlog", "VERBOSE"); err == nil {
+		t.Errorf("invalid level should return error")
+	}
+	if err := RedirectStdLog("stdlog/debug", LvNameDebug); err != nil {
+		t.Fatalf("redirect std log error: %s", err)
+	}
+	log.Print("filtered")
+	if err := RedirectStdLog("stdlog", LvNameNotice); err != nil {
+		t.Fatalf("redirect std log error: %s", err)
+	}
+	log.Printf("hello %s", "std log")
+	_, _, line, _ := runtime.Caller(0)
+	Close()
+
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("read log file error: %s", err)
+	}
+	expect := fmt.Sprintf(`"level":"NOTICE","logger":"stdlog","file":"slog_test.go","line":%d,"msg":"hello std log"`, line-1)
+	if !strings.Contains(string(data), expect) || strings.Contains(string(data), "filtered") {
+		t.Errorf("log file content: %s, expect: %s", data, expect)
+	}
+}
+
+func TestContext(t *testing.T) {
+	type traceKey struct{}
+	type slogPkgInfo struct{}
+	logger := GetLogger(slogPkgInfo{})
+	defer Configure(Config{})
+	logFile := filepath.Join(t.TempDir(), "app.log")
+	err := Configure(Config{
+		Writers: []WriterConfig{{Name: "file", File: logFile, Format: FormatJSON}},
+		Loggers: []LoggerConfig{{Pattern: "*", Level: LvNameInfo, Writers: []string{"file"}}},
+	})
+	if err != nil {
+		t.Fatalf("configure error: %s", err)
+	}
+
+	if FromContext(context.Background()) != logger {
+		t.Errorf("logger of caller's package should be returned")
+	}
+	RegisterContextKey(traceKey{}, "trace")
+	ctx := context.WithValue(context.Background(), traceKey{}, "abc")
+	ctx = NewContext(ctx, logger.With("user", 42))
+	FromContext(ctx).DebugCtx(ctx, "filtered")
+	FromContext(ctx).InfoCtx(ctx, "with context")
+	Close()
+
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("read log file error: %s", err)
+	}
+	expect := `"msg":"with context","fields":{"user":42,"trace":"abc"}`
+	if !strings.Contains(string(data), expect) || strings.Contains(string(data), "filtered") {
+		t.Errorf("log file content: %s, expect: %s", data, expect)
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	defer Configure(Config{})
+	devNull := []WriterConfig{{Name: "null", File: os.DevNull}}
+	confs := []Config{
+		{Writers: devNull, Loggers: []LoggerConfig{{Pattern: "*", Level: LvNameDebug, Writers: []string{"null"}}}},
+		{Writers: devNull, Loggers: []LoggerConfig{{Pattern: "stress/*", Level: LvNameWarn, Writers: []string{"null"}}}},
+	}
+	if err := Configure(confs[0]); err != nil {
+		t.Fatalf("configure error: %s", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				logger := GetLoggerWithPath(fmt.Sprintf("stress/pkg%d", j%10))
+				logger.With("goroutine", i).Infow("stress", "j", j)
+				logger.Debugf("stress %d", j)
+				if logger.IsWarnEnabled() && j%50 == 0 {
+					logger.SetLevel(LvNameInfo)
+				}
+			}
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 20; j++ {
+			if err := Configure(confs[j%2]); err != nil {
+				t.Errorf("configure error: %s", err)
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+func benchmarkLogger(b *testing.B, level string) Logger {
+	b.Helper()
+	err := Configure(Config{
+		Writers: []WriterConfig{{Name: "null", File: os.DevNull}},
+		Loggers: []LoggerConfig{{Pattern: "*", Level: level, Writers: []string{"null"}}},
+	})
+	if err != nil {
+		b.Fatalf("configure error: %s", err)
+	}
+	b.Cleanup(func() { Configure(Config{}) })
+	return GetLoggerWithPath("bench")
+}
+
+func BenchmarkDisabled(b *testing.B) {
+	logger := benchmarkLogger(b, LvNameInfo)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			logger.Debug("disabled")
+		}
+	})
+}
+
+func BenchmarkDisabledf(b *testing.B) {
+	logger := benchmarkLogger(b, LvNameInfo)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			logger.Debugf("disabled %d", 1)
+		}
+	})
+}
+
+func BenchmarkEnabled(b *testing.B) {
+	logger := benchmarkLogger(b, LvNameInfo)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			logger.Info("enabled")
+		}
+	})
 }
@@ -0,0 +1,246 @@
+// Package slogtest helps tests to assert logs written by slog loggers.
+//
+//	func TestServe(t *testing.T) {
+//		rec := slogtest.Capture(t, "github.com/org/app/server")
+//		serve()
+//		if len(rec.Level(slog.LvNameError)) > 0 {
+//			t.Errorf("unexpected errors: %v", rec.Level(slog.LvNameError))
+//		}
+//	}
+package slogtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kuun/slog"
+	"github.com/kuun/slog/buffer"
+	"github.com/kuun/slog/writer"
+)
+
+// writer types of slogtest
+const (
+	// RECORDER is the type of Recorder
+	RECORDER writer.Type = "RECORDER"
+	// TESTING is the type of writer of the logger created by NewLogger
+	TESTING writer.Type = "TESTING"
+)
+
+// Record is a log record captured by Recorder
+type Record struct {
+	Time   time.Time
+	Level  string // level name, e.g. "INFO"
+	Path   string // logger path
+	File   string
+	Line   int
+	Msg    string
+	Fields map[string]interface{} // numbers are json.Number
+}
+
+// Field returns the value of field key as a string, ok is false if the
+// record has no such field.
+func (r Record) Field(key string) (value string, ok bool) {
+	v, ok := r.Fields[key]
+	if !ok {
+		return "", false
+	}
+	if s, isString := v.(string); isString {
+		return s, true
+	}
+	return fmt.Sprint(v), true
+}
+
+// Recorder is an in-memory log writer keeping records in the order they are
+// written, records must be formatted as json. It writes synchronously, so
+// a record is captured when the log method returns.
+type Recorder struct {
+	mu      sync.Mutex
+	name    string
+	records []Record
+}
+
+// NewRecorder creates a recorder, it's attached to loggers by
+// slog.AttachWriter with format slog.FormatJSON, or by Capture.
+func NewRecorder() *Recorder {
+	return &Recorder{name: "slogtest"}
+}
+
+// NewLogger returns a logger writing records by t.Log, so they are shown
+// with the output of the test, only if it fails or runs with -v. Records
+// are formatted by slog.FormatShort, e.g. "INFO worker.go:42] started", the
+// location t.Log labels a line with is inside slog, not the log call. The
+// level of the logger is DEBUG until SetLevel is called, records written
+// after the test finishes are dropped.
+func NewLogger(t testing.TB) slog.Logger {
+	t.Helper()
+	wr := &tWriter{t: t}
+	t.Cleanup(func() {
+		wr.mu.Lock()
+		wr.done = true
+		wr.mu.Unlock()
+	})
+	logger, err := slog.NewLogger("slogtest/"+t.Name(), slog.FormatShort, wr)
+	if err != nil {
+		t.Fatalf("create logger error: %s", err)
+	}
+	return logger
+}
+
+// tWriter is a log writer writing by t.Log
+type tWriter struct {
+	t    testing.TB
+	mu   sync.Mutex
+	done bool // the test finished, t.Log can't be called
+}
+
+func (w *tWriter) SetName(name string) {
+}
+
+func (w *tWriter) GetName() string {
+	return "slogtest"
+}
+
+func (w *tWriter) GetType() writer.Type {
+	return TESTING
+}
+
+func (w *tWriter) Write(buff *buffer.Buffer) {
+	line := strings.TrimSuffix(buff.String(), "\n")
+	buffer.PutBuffer(buff)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.done {
+		w.t.Log(line)
+	}
+}
+
+func (w *tWriter) Run() {
+}
+
+func (w *tWriter) Close() {
+}
+
+// Capture attaches a new recorder to loggers of path and its sub packages,
+// the recorder is detached when the test finishes.
+func Capture(t testing.TB, path string) *Recorder {
+	t.Helper()
+	rec := NewRecorder()
+	detach, err := slog.AttachWriter(path, slog.FormatJSON, rec)
+	if err != nil {
+		t.Fatalf("attach recorder error: %s", err)
+	}
+	t.Cleanup(detach)
+	return rec
+}
+
+func (rec *Recorder) SetName(name string) {
+	rec.name = name
+}
+
+func (rec *Recorder) GetName() string {
+	return rec.name
+}
+
+func (rec *Recorder) GetType() writer.Type {
+	return RECORDER
+}
+
+// jsonRecord is a record encoded by slog.FormatJSON
+type jsonRecord struct {
+	Time   time.Time              `json:"ts"`
+	Level  string                 `json:"level"`
+	Logger string                 `json:"logger"`
+	File   string                 `json:"file"`
+	Line   int                    `json:"line"`
+	Msg    string                 `json:"msg"`
+	Fields map[string]interface{} `json:"fields"`
+}
+
+// Write decodes buff to a record, a line which isn't json is kept as the
+// message of a record.
+func (rec *Recorder) Write(buff *buffer.Buffer) {
+	var jr jsonRecord
+	dec := json.NewDecoder(bytes.NewReader(buff.Bytes()))
+	dec.UseNumber()
+	r := Record{Msg: strings.TrimSuffix(buff.String(), "\n")}
+	if err := dec.Decode(&jr); err == nil {
+		r = Record{
+			Time:   jr.Time,
+			Level:  jr.Level,
+			Path:   jr.Logger,
+			File:   jr.File,
+			Line:   jr.Line,
+			Msg:    jr.Msg,
+			Fields: jr.Fields,
+		}
+	}
+	buffer.PutBuffer(buff)
+	rec.mu.Lock()
+	rec.records = append(rec.records, r)
+	rec.mu.Unlock()
+}
+
+// Run does nothing, records are captured by Write
+func (rec *Recorder) Run() {
+}
+
+// Close does nothing, captured records are kept
+func (rec *Recorder) Close() {
+}
+
+// Records returns all captured records
+func (rec *Recorder) Records() []Record {
+	return rec.Filter(func(Record) bool { return true })
+}
+
+// Len returns the count of captured records
+func (rec *Recorder) Len() int {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return len(rec.records)
+}
+
+// Reset drops all captured records
+func (rec *Recorder) Reset() {
+	rec.mu.Lock()
+	rec.records = nil
+	rec.mu.Unlock()
+}
+
+// Filter returns captured records which f returns true for
+func (rec *Recorder) Filter(f func(r Record) bool) []Record {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	var records []Record
+	for _, r := range rec.records {
+		if f(r) {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+// Level returns captured records of level, e.g. slog.LvNameError
+func (rec *Recorder) Level(level string) []Record {
+	return rec.Filter(func(r Record) bool { return r.Level == level })
+}
+
+// Message returns captured records whose message contains substr
+func (rec *Recorder) Message(substr string) []Record {
+	return rec.Filter(func(r Record) bool { return strings.Contains(r.Msg, substr) })
+}
+
+// Field returns captured records which have field key of value, values are
+// compared in their string form, e.g. Field("user", 42).
+func (rec *Recorder) Field(key string, value interface{}) []Record {
+	expect := fmt.Sprint(value)
+	return rec.Filter(func(r Record) bool {
+		v, ok := r.Field(key)
+		return ok && v == expect
+	})
+}
@@ -0,0 +1,95 @@
+package slogtest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kuun/slog"
+)
+
+func TestCapture(t *testing.T) {
+	const path = "github.com/kuun/slog/slogtest/capture"
+	logger := slog.GetLoggerWithPath(path)
+	logger.SetLevel(slog.LvNameDebug)
+	rec := Capture(t, path)
+
+	logger.Debug("starting")
+	logger.With("user", 42).Infow("login", "ok", true)
+	logger.Errorw("query failed", "user", 7, "err", "timeout")
+	slog.GetLoggerWithPath(path + "/db").Warn("slow query")
+	slog.GetLoggerWithPath("github.com/kuun/other").Error("not captured")
+
+	if rec.Len() != 4 {
+		t.Fatalf("captured %d records: %+v", rec.Len(), rec.Records())
+	}
+	r := rec.Records()[1]
+	if r.Level != slog.LvNameInfo || r.Path != path || r.Msg != "login" || r.File != "slogtest_test.go" || r.Line == 0 {
+		t.Errorf("captured record: %+v", r)
+	}
+	if v, ok := r.Field("ok"); !ok || v != "true" {
+		t.Errorf("field ok: %q, %v", v, ok)
+	}
+	if records := rec.Field("user", 42); len(records) != 1 || records[0].Msg != "login" {
+		t.Errorf("records of user 42: %+v", records)
+	}
+	if records := rec.Level(slog.LvNameError); len(records) != 1 || records[0].Msg != "query failed" {
+		t.Errorf("error records: %+v", records)
+	}
+	if records := rec.Message("slow"); len(records) != 1 || records[0].Path != path+"/db" {
+		t.Errorf("slow records: %+v", records)
+	}
+
+	rec.Reset()
+	logger.Info("after reset")
+	if rec.Len() != 1 {
+		t.Errorf("captured %d records after reset", rec.Len())
+	}
+}
+
+func TestDetach(t *testing.T) {
+	const path = "github.com/kuun/slog/slogtest/detach"
+	logger := slog.GetLoggerWithPath(path)
+	logger.SetLevel(slog.LvNameWarn)
+	var rec *Recorder
+	t.Run("capture", func(t *testing.T) {
+		rec = Capture(t, path)
+		// the level set by SetLevel is kept by attaching
+		logger.Info("filtered")
+		logger.Warn("captured")
+	})
+	// the recorder is detached by cleanup of the sub test
+	logger.Warn("not captured")
+	if rec.Len() != 1 {
+		t.Errorf("captured %d records after detach", rec.Len())
+	}
+	if level := logger.GetLevel(); level != slog.LvNameWarn {
+		t.Errorf("level after detach: %s", level)
+	}
+}
+
+// logT is a testing.TB keeping lines written by Log
+type logT struct {
+	testing.TB
+	lines []string
+}
+
+func (t *logT) Log(args ...interface{}) {
+	t.lines = append(t.lines, fmt.Sprint(args...))
+}
+
+func TestNewLogger(t *testing.T) {
+	lt := &logT{TB: t}
+	logger := NewLogger(lt)
+	logger.Debug("debug")
+	logger.SetLevel(slog.LvNameWarn)
+	logger.Info("info")
+	logger.Warnw("warn", "user", 42)
+	if len(lt.lines) != 2 || !strings.HasSuffix(lt.lines[0], "] debug") || !strings.HasSuffix(lt.lines[1], "] warn user=42") {
+		t.Fatalf("logged lines: %q", lt.lines)
+	}
+	// lines have no time and logger path, t.Log labels them
+	if !strings.HasPrefix(lt.lines[0], "DEBUG slogtest_test.go:") || !strings.HasPrefix(lt.lines[1], "WARN slogtest_test.go:") {
+		t.Errorf("logged lines: %q", lt.lines)
+	}
+}
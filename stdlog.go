@@ -0,0 +1,68 @@
+package slog
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stdLogWriter is the output of package log, it writes every line by a
+// logger of slog.
+type stdLogWriter struct {
+	logger *loggerImpl
+	level  Level
+}
+
+// RedirectStdLog redirects the output of package log to the logger of path,
+// lines are written at level. The flags of package log are set to
+// log.Lshortfile, so the file and line of the caller of package log are
+// written in records.
+func RedirectStdLog(path string, level string) error {
+	lv, ok := parseLevel(level)
+	if !ok {
+		return errors.New("unkown log level name: " + level)
+	}
+	logger := GetLoggerWithPath(path).(*loggerImpl)
+	log.SetFlags(log.Lshortfile)
+	log.SetPrefix("")
+	log.SetOutput(&stdLogWriter{logger: logger, level: lv})
+	return nil
+}
+
+// Write writes a line of package log, the "file:line: " prefix written by
+// log.Lshortfile is parsed to the location of the record.
+func (w *stdLogWriter) Write(p []byte) (int, error) {
+	if !w.logger.enabled(w.level) {
+		return len(p), nil
+	}
+	msg := strings.TrimSuffix(string(p), "\n")
+	file, line := "???", 1
+	if colon := strings.Index(msg, ": "); colon > 0 {
+		if f, l, ok := parseFileLine(msg[:colon]); ok {
+			file, line, msg = f, l, msg[colon+2:]
+		}
+	}
+	w.logger.write(&record{
+		time:  time.Now(),
+		level: w.level,
+		file:  file,
+		line:  line,
+		msg:   msg,
+	})
+	return len(p), nil
+}
+
+// parseFileLine parses "file.go:line"
+func parseFileLine(s string) (file string, line int, ok bool) {
+	colon := strings.LastIndexByte(s, ':')
+	if colon <= 0 || !strings.HasSuffix(s[:colon], ".go") {
+		return "", 0, false
+	}
+	line, err := strconv.Atoi(s[colon+1:])
+	if err != nil {
+		return "", 0, false
+	}
+	return shortFile(s[:colon]), line, true
+}
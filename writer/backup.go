@@ -0,0 +1,373 @@
+package writer
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// suffix of compressed backups
+const gzSuffix = ".gz"
+
+// interval to sweep expired backups even if there is no rotation
+const sweepInterval = time.Hour
+
+// backup is a rotated log file
+type backup struct {
+	path       string
+	index      int
+	compressed bool
+	modTime    time.Time
+}
+
+func backupName(fileName string, index int) string {
+	return fileName + "." + strconv.Itoa(index)
+}
+
+// listBackups returns rotated files of fileName, sorted by index descending,
+// which is from the oldest to the newest.
+func listBackups(fileName string) ([]backup, error) {
+	dir, base := filepath.Split(fileName)
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var backups []backup
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, base+".") {
+			continue
+		}
+		suffix := name[len(base)+1:]
+		compressed := strings.HasSuffix(suffix, gzSuffix)
+		index, err := strconv.Atoi(strings.TrimSuffix(suffix, gzSuffix))
+		if err != nil || index <= 0 {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{
+			path:       filepath.Join(dir, name),
+			index:      index,
+			compressed: compressed,
+			modTime:    info.ModTime(),
+		})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].index > backups[j].index
+	})
+	return backups, nil
+}
+
+// pendingSuffix is the suffix of a file rotated by the writing go routine,
+// followed by the time in nanoseconds, the backup worker renames it to the
+// first backup.
+const pendingSuffix = ".rotating."
+
+// listPending returns files rotated from fileName before the time since,
+// which are not renamed to backups, e.g. the process exited before the
+// backup worker renamed them. They're sorted from the oldest to the newest.
+func listPending(fileName string, since time.Time) ([]string, error) {
+	dir, base := filepath.Split(fileName)
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	type pending struct {
+		path string
+		ts   int64
+	}
+	var files []pending
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, base+pendingSuffix) {
+			continue
+		}
+		ts, err := strconv.ParseInt(name[len(base)+len(pendingSuffix):], 10, 64)
+		if err != nil || ts >= since.UnixNano() {
+			continue
+		}
+		files = append(files, pending{filepath.Join(dir, name), ts})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ts < files[j].ts
+	})
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.path
+	}
+	return paths, nil
+}
+
+// shiftBackups renames every backup of fileName to the next index, backups
+// whose new index exceeds maxBackups are removed, 0 maxBackups keeps all.
+func shiftBackups(fileName string, maxBackups int) error {
+	backups, err := listBackups(fileName)
+	if err != nil {
+		return err
+	}
+	for _, b := range backups {
+		if maxBackups > 0 && b.index+1 > maxBackups {
+			if err := os.Remove(b.path); err != nil {
+				return err
+			}
+			continue
+		}
+		newPath := backupName(fileName, b.index+1)
+		if b.compressed {
+			newPath += gzSuffix
+		}
+		if err := os.Rename(b.path, newPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeExpiredBackups removes backups of fileName older than maxAge,
+// 0 maxAge keeps all.
+func removeExpiredBackups(fileName string, maxAge time.Duration) error {
+	if maxAge <= 0 {
+		return nil
+	}
+	backups, err := listBackups(fileName)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(-maxAge)
+	for _, b := range backups {
+		if b.modTime.Before(deadline) {
+			if err := os.Remove(b.path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// removeExpiredFiles removes regular files which match both glob and files,
+// and are older than maxAge, except the file named keep, 0 maxAge keeps all.
+func removeExpiredFiles(glob string, files *regexp.Regexp, maxAge time.Duration, keep string) error {
+	if maxAge <= 0 {
+		return nil
+	}
+	names, err := filepath.Glob(glob)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(-maxAge)
+	for _, name := range names {
+		if name == keep || !files.MatchString(filepath.Clean(name)) {
+			continue
+		}
+		info, err := os.Lstat(name)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if info.ModTime().Before(deadline) {
+			if err := os.Remove(name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compressFile compresses path to path.gz with gzip and removes path, the
+// partly written file is removed if compressing fails.
+func compressFile(path string) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	tmp := path + gzSuffix + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp)
+		}
+	}()
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err = gz.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+	// keep modification time, so the backup is expired by its last write
+	os.Chtimes(tmp, info.ModTime(), info.ModTime())
+	if err = os.Rename(tmp, path+gzSuffix); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// updateLink points link to fileName, the link is replaced atomically by
+// renaming a temporary link to it.
+func updateLink(fileName, link string) error {
+	target := fileName
+	if filepath.Dir(fileName) == filepath.Dir(link) {
+		target = filepath.Base(fileName)
+	}
+	tmp := link + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, link)
+}
+
+// backupJob is a file closed by the writing go routine, the backup worker
+// makes it a backup.
+type backupJob struct {
+	fileName string // the log file which path is rotated from
+	path     string // the closed file
+	rotated  bool   // path is rotated by size, it should become backup 1
+}
+
+// backupWorker manages backups of a file writer in background, it shifts,
+// compresses and removes expired backups, so the writing go routine never
+// blocks on them.
+type backupWorker struct {
+	opts      FileOptions
+	pattern   *timePattern
+	jobChn    chan *backupJob
+	jobsDone  chan bool
+	since     time.Time     // files rotated before it are left by a previous run
+	done      chan struct{} // closed by close, run returns
+	closeOnce sync.Once
+}
+
+const backupJobCache = 16
+
+func newBackupWorker(opts FileOptions, pattern *timePattern) *backupWorker {
+	return &backupWorker{
+		opts:     opts,
+		pattern:  pattern,
+		jobChn:   make(chan *backupJob, backupJobCache),
+		jobsDone: make(chan bool),
+		since:    time.Now(),
+		done:     make(chan struct{}),
+	}
+}
+
+func (worker *backupWorker) run(fileName string) {
+	worker.recoverPending(fileName)
+	var tick <-chan time.Time
+	if worker.opts.MaxAge > 0 {
+		ticker := time.NewTicker(sweepInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case job := <-worker.jobChn:
+			if job == nil {
+				worker.jobsDone <- true
+				continue
+			}
+			worker.handle(job)
+			fileName = job.fileName
+		case <-tick:
+			worker.sweep(fileName)
+		case <-worker.done:
+			return
+		}
+	}
+}
+
+// recoverPending makes backups of files rotated from fileName but left
+// pending by a previous run, from the oldest to the newest, so the newest
+// becomes backup 1.
+func (worker *backupWorker) recoverPending(fileName string) {
+	pending, err := listPending(fileName, worker.since)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "list pending log backups error: %s\n", err)
+		return
+	}
+	for _, path := range pending {
+		worker.handle(&backupJob{fileName: fileName, path: path, rotated: true})
+	}
+}
+
+// flush waits all queued jobs done
+func (worker *backupWorker) flush() {
+	worker.jobChn <- nil
+	<-worker.jobsDone
+}
+
+// close waits all queued jobs done and stops the worker, no job can be
+// queued after it.
+func (worker *backupWorker) close() {
+	worker.closeOnce.Do(func() {
+		worker.flush()
+		close(worker.done)
+	})
+}
+
+func (worker *backupWorker) handle(job *backupJob) {
+	path := job.path
+	if job.rotated {
+		if err := shiftBackups(job.fileName, worker.opts.MaxBackups); err != nil {
+			fmt.Fprintf(os.Stderr, "shift log backups error: %s\n", err)
+		}
+		path = backupName(job.fileName, 1)
+		if err := os.Rename(job.path, path); err != nil {
+			fmt.Fprintf(os.Stderr, "rename log backup error: %s\n", err)
+			return
+		}
+	}
+	if worker.opts.Compress {
+		if err := compressFile(path); err != nil {
+			fmt.Fprintf(os.Stderr, "compress log backup error: %s\n", err)
+		}
+	}
+	worker.sweep(job.fileName)
+}
+
+// sweep removes expired backups of fileName, and files of previous periods
+// if the file writer has a time pattern.
+func (worker *backupWorker) sweep(fileName string) {
+	if err := removeExpiredBackups(fileName, worker.opts.MaxAge); err != nil {
+		fmt.Fprintf(os.Stderr, "remove expired log backups error: %s\n", err)
+	}
+	if worker.pattern == nil {
+		return
+	}
+	glob := worker.pattern.glob()
+	current := filepath.Clean(worker.pattern.format(time.Now()))
+	for _, g := range []string{glob, glob + ".*"} {
+		if err := removeExpiredFiles(g, worker.pattern.files, worker.opts.MaxAge, current); err != nil {
+			fmt.Fprintf(os.Stderr, "remove expired log files error: %s\n", err)
+		}
+	}
+}
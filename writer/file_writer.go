@@ -1,44 +1,172 @@
 package writer
 
 import (
+	"bufio"
 	"fmt"
 	"os"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/kuun/slog/buffer"
 )
 
 type fileWriter struct {
-	wType     Type                // writer type
-	name      string              // writer name
-	file      *os.File            // log file
-	cacheChn  chan *buffer.Buffer // cache buffers that will be writing.
-	flushDone chan bool           // all cached buffers are flush to file
-	isRunning bool                // if writer's writing gorotine is running
+	wType     Type          // writer type
+	name      string        // writer name
+	fileName  string        // current log file name, empty for STDOUT and STDERR
+	pattern   *timePattern  // file name pattern, nil if file isn't switched by time
+	opts      FileOptions   // rotation options
+	file      *os.File      // log file
+	out       *bufio.Writer // buffers writes to file, nil if not buffered
+	size      int64         // current size of log file
+	nextOpen  time.Time     // time to switch to the file of next period
+	worker    *backupWorker // manages backups, nil for STDOUT and STDERR
+	queue     *queue        // buffers that will be writing
+	flushDone chan bool     // all cached buffers are flush to file
+	isRunning bool          // if writer's writing gorotine is running
+	runMu     sync.Mutex    // protects isRunning
 }
 
-const fileWriterCache = 5
+// FileOptions are the rotation options of file log writer, zero value
+// disables rotation.
+type FileOptions struct {
+	// MaxSize is the max size in bytes of log file, the file is rotated
+	// before it grows beyond MaxSize. 0 means no limit.
+	MaxSize int64
+	// MaxBackups is the max count of rotated files to keep, 0 keeps all.
+	MaxBackups int
+	// MaxAge is the max age of rotated files to keep, 0 keeps all. For a
+	// time pattern, files of previous periods older than MaxAge are removed
+	// too.
+	MaxAge time.Duration
+	// Link is a symbolic link pointing to current log file, it's useful
+	// when the file name is a time pattern. Empty means no link.
+	Link string
+	// Compress compresses rotated files and files of previous periods with
+	// gzip in background.
+	Compress bool
+	// Queue is the options of the queue of buffers being written.
+	Queue QueueOptions
+	// BufferSize is the size in bytes of the buffer coalescing writes to
+	// file, 0 means every buffer is written by a syscall. Buffered data is
+	// flushed when the buffer is full, every FlushInterval, after an ERROR
+	// or FATAL record, and by Flush.
+	BufferSize int
+	// FlushInterval is the interval of flushing buffered data, 0 means
+	// DefaultFlushInterval.
+	FlushInterval time.Duration
+}
+
+// Flusher is implemented by log writers which buffer data
+type Flusher interface {
+	// Flush writes all data written before it, it returns after the data is
+	// written.
+	Flush()
+}
+
+// errorLevel is the ERROR level of slog, buffered records are flushed at
+// once after a record at or above it
+const errorLevel = 4
+
+const fileWriterCache = 64
 
 // NewFileWriter creates a new file log writer
 func NewFileWriter(name, fileName string) (wr LogWriter, err error) {
-	var file *os.File
+	return NewFileWriterWithOptions(name, fileName, FileOptions{})
+}
+
+// NewFileWriterWithOptions creates a new file log writer which rotates log
+// file as opts specified. Rotated files are named by appending an index to
+// the file name, e.g. app.log.1 is the newest, app.log.2 is older.
+//
+// fileName can be a time pattern like "/var/log/app-%Y%m%d.log", the writer
+// switches to a new file when the period of the pattern changes, see
+// timePattern for supported conversions.
+func NewFileWriterWithOptions(name, fileName string, opts FileOptions) (wr LogWriter, err error) {
+	q, err := newQueue(opts.Queue, fileWriterCache)
+	if err != nil {
+		return nil, err
+	}
+	writer := &fileWriter{
+		wType:     FILE,
+		name:      name,
+		opts:      opts,
+		queue:     q,
+		flushDone: make(chan bool),
+	}
 	switch name {
 	case "STDOUT":
-		file = os.Stdout
+		writer.file = os.Stdout
 	case "STDERR":
-		file = os.Stderr
+		writer.file = os.Stderr
 	default:
-		file, err = os.OpenFile(fileName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666|os.ModeAppend)
-		if err != nil {
+		writer.fileName = fileName
+		if isTimePattern(fileName) {
+			if writer.pattern, err = parseTimePattern(fileName); err != nil {
+				return nil, err
+			}
+		}
+		if err = writer.openFile(time.Now()); err != nil {
 			return nil, err
 		}
+		writer.worker = newBackupWorker(opts, writer.pattern)
 	}
-	return &fileWriter{
-		wType:     FILE,
-		name:      name,
-		file:      file,
-		cacheChn:  make(chan *buffer.Buffer, fileWriterCache),
-		flushDone: make(chan bool),
-	}, nil
+	if opts.BufferSize > 0 {
+		if writer.opts.FlushInterval <= 0 {
+			writer.opts.FlushInterval = DefaultFlushInterval
+		}
+		writer.out = bufio.NewWriterSize(writer.file, opts.BufferSize)
+	}
+	return writer, nil
+}
+
+// openFile opens the log file of the period which now belongs to and points
+// the link to it, current file is kept if the new one can't be opened.
+func (writer *fileWriter) openFile(now time.Time) error {
+	fileName := writer.fileName
+	if writer.pattern != nil {
+		fileName = writer.pattern.format(now)
+		writer.nextOpen = writer.pattern.next(now)
+	}
+	file, size, err := openLogFile(fileName)
+	if err != nil {
+		return err
+	}
+	if writer.file != nil {
+		writer.flush()
+		writer.file.Close()
+		writer.worker.jobChn <- &backupJob{fileName: fileName, path: writer.fileName}
+	}
+	writer.setFile(file, size)
+	writer.fileName = fileName
+	if writer.opts.Link != "" {
+		return updateLink(fileName, writer.opts.Link)
+	}
+	return nil
+}
+
+// setFile makes file current log file, buffered data must be flushed to
+// previous file before.
+func (writer *fileWriter) setFile(file *os.File, size int64) {
+	writer.file = file
+	writer.size = size
+	if writer.out != nil {
+		writer.out.Reset(file)
+	}
+}
+
+func openLogFile(fileName string) (*os.File, int64, error) {
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666|os.ModeAppend)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
 }
 
 func (writer *fileWriter) SetName(name string) {
@@ -54,35 +182,163 @@ func (writer *fileWriter) GetType() Type {
 }
 
 func (writer *fileWriter) Write(buff *buffer.Buffer) {
-	writer.cacheChn <- buff
+	writer.queue.put(buff)
+}
+
+// Dropped returns the count of buffers dropped by the overflow policy
+func (writer *fileWriter) Dropped() uint64 {
+	return writer.queue.dropped.Load()
 }
 
 // Run starts a go routine to write buffers to file
 func (writer *fileWriter) Run() {
+	writer.runMu.Lock()
+	defer writer.runMu.Unlock()
 	if writer.isRunning {
 		return
 	}
 	go func() {
+		defer close(writer.queue.stopped)
+		var tick <-chan time.Time
+		if writer.out != nil {
+			ticker := time.NewTicker(writer.opts.FlushInterval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
 		for {
-			buff := <-writer.cacheChn
-			if buff == nil {
-				writer.flushDone <- true
-				continue
-			}
-			if _, err := writer.file.Write(buff.Bytes()); err != nil {
-				fmt.Fprintf(os.Stderr, "write log error: %s\n", err)
+			select {
+			case buff := <-writer.queue.ch:
+				if buff == nil {
+					writer.flush()
+					writer.flushDone <- true
+					continue
+				}
+				writer.write(buff)
+				buffer.PutBuffer(buff)
+			case <-tick:
+				writer.flush()
+			case <-writer.queue.done:
+				writer.flush()
+				return
 			}
-			buffer.PutBuffer(buff)
 		}
 	}()
+	if writer.worker != nil {
+		go writer.worker.run(writer.fileName)
+	}
 	writer.isRunning = true
 }
 
+// write writes a buffer to file, rotates the file first if it's too large,
+// it's called only by the writing go routine.
+func (writer *fileWriter) write(buff *buffer.Buffer) {
+	if writer.pattern != nil {
+		if now := time.Now(); !now.Before(writer.nextOpen) {
+			writer.switchFile(now)
+		}
+	}
+	if writer.needRotate(buff.Len()) {
+		if err := writer.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "rotate log file error: %s\n", err)
+		}
+	}
+	if writer.out == nil {
+		n, err := writer.file.Write(buff.Bytes())
+		writer.size += int64(n)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "write log error: %s\n", err)
+		}
+		return
+	}
+	n, err := writer.out.Write(buff.Bytes())
+	writer.size += int64(n)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "write log error: %s\n", err)
+	}
+	if buff.Level >= errorLevel {
+		writer.flush()
+	}
+}
+
+// flush writes buffered data to file
+func (writer *fileWriter) flush() {
+	if writer.out == nil || writer.out.Buffered() == 0 {
+		return
+	}
+	if err := writer.out.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "write log error: %s\n", err)
+		// drop data can't be written, or all later writes fail
+		writer.out.Reset(writer.file)
+	}
+}
+
+// switchFile switches to the file of the period which now belongs to, the
+// file of previous period is passed to the backup worker.
+func (writer *fileWriter) switchFile(now time.Time) {
+	if err := writer.openFile(now); err != nil {
+		fmt.Fprintf(os.Stderr, "switch log file error: %s\n", err)
+	}
+}
+
+func (writer *fileWriter) needRotate(n int) bool {
+	if writer.fileName == "" || writer.opts.MaxSize <= 0 {
+		return false
+	}
+	// a line larger than MaxSize is written to an empty file
+	return writer.size > 0 && writer.size+int64(n) > writer.opts.MaxSize
+}
+
+// rotate renames current log file to a pending name and opens a new one,
+// the backup worker renames the pending file to the first backup later.
+// The current file is kept if the new file can't be opened.
+func (writer *fileWriter) rotate() error {
+	pending := writer.fileName + pendingSuffix + strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err := os.Rename(writer.fileName, pending); err != nil {
+		return err
+	}
+	file, size, err := openLogFile(writer.fileName)
+	if err != nil {
+		os.Rename(pending, writer.fileName)
+		return err
+	}
+	writer.flush()
+	writer.file.Close()
+	writer.setFile(file, size)
+	writer.worker.jobChn <- &backupJob{fileName: writer.fileName, path: pending, rotated: true}
+	return nil
+}
+
+// Flush writes all buffers written before it to file
+func (writer *fileWriter) Flush() {
+	writer.runMu.Lock()
+	isRunning := writer.isRunning
+	writer.runMu.Unlock()
+	if isRunning {
+		writer.Write(nil)
+		select {
+		case <-writer.flushDone:
+		case <-writer.queue.stopped:
+		}
+	}
+}
+
+// Close writes all cached buffers, stops the writing go routine and the
+// backup worker, and closes the log file.
 func (writer *fileWriter) Close() {
-	writer.Write(nil)
-	_ = <-writer.flushDone
-	if writer.name == "STDOUT" || writer.name == "STDERR" {
+	writer.runMu.Lock()
+	isRunning := writer.isRunning
+	writer.runMu.Unlock()
+	if !isRunning {
+		if writer.fileName != "" {
+			writer.file.Close()
+		}
+		return
+	}
+	writer.Flush()
+	writer.queue.stop()
+	if writer.fileName == "" {
 		return
 	}
+	writer.worker.close()
 	writer.file.Close()
 }
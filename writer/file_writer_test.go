@@ -0,0 +1,273 @@
+package writer
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kuun/slog/buffer"
+)
+
+// lineBuffer returns a buffer holding line at level
+func lineBuffer(level int, line string) *buffer.Buffer {
+	buff := buffer.GetBuffer()
+	buff.Level = level
+	buff.WriteString(line)
+	buff.WriteByte('\n')
+	return buff
+}
+
+func writeLine(wr LogWriter, line string) {
+	writeLevelLine(wr, 0, line)
+}
+
+func writeLevelLine(wr LogWriter, level int, line string) {
+	wr.Write(lineBuffer(level, line))
+}
+
+func readFile(t *testing.T, name string) string {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("read file error: %s", err)
+	}
+	return string(data)
+}
+
+func TestFileWriterRotate(t *testing.T) {
+	// rotation works the same whether writes are buffered or not
+	for _, bufferSize := range []int{0, 1024} {
+		fileName := filepath.Join(t.TempDir(), "app.log")
+		wr, err := NewFileWriterWithOptions("file", fileName, FileOptions{MaxSize: 20, MaxBackups: 2, BufferSize: bufferSize})
+		if err != nil {
+			t.Fatalf("create file writer error: %s", err)
+		}
+		wr.Run()
+		// every line is 10 bytes, every file holds 2 lines
+		for _, line := range []string{"line00001", "line00002", "line00003", "line00004", "line00005", "line00006", "line00007"} {
+			writeLine(wr, line)
+		}
+		wr.Close()
+
+		expects := map[string]string{
+			fileName:                "line00007\n",
+			backupName(fileName, 1): "line00005\nline00006\n",
+			backupName(fileName, 2): "line00003\nline00004\n",
+		}
+		for name, expect := range expects {
+			if content := readFile(t, name); content != expect {
+				t.Errorf("file %s content: %q, expect: %q", name, content, expect)
+			}
+		}
+		if _, err := os.Stat(backupName(fileName, 3)); !os.IsNotExist(err) {
+			t.Errorf("backup 3 should be removed, error: %v", err)
+		}
+	}
+}
+
+func TestFileWriterBuffer(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "app.log")
+	wr, err := NewFileWriterWithOptions("file", fileName, FileOptions{BufferSize: 1024, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("create file writer error: %s", err)
+	}
+	wr.Run()
+	defer wr.Close()
+
+	writeLevelLine(wr, 1, "info")
+	wr.(Flusher).Flush()
+	if content := readFile(t, fileName); content != "info\n" {
+		t.Errorf("content after flush: %q", content)
+	}
+	writeLevelLine(wr, 1, "info")
+	// an ERROR record flushes buffered records at once
+	writeLevelLine(wr, 4, "error")
+	expect := "info\ninfo\nerror\n"
+	for i := 0; i < 100 && readFile(t, fileName) != expect; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if content := readFile(t, fileName); content != expect {
+		t.Errorf("content after error: %q, expect: %q", content, expect)
+	}
+}
+
+func TestFileWriterFlushInterval(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "app.log")
+	wr, err := NewFileWriterWithOptions("file", fileName, FileOptions{BufferSize: 1024, FlushInterval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("create file writer error: %s", err)
+	}
+	wr.Run()
+	defer wr.Close()
+
+	writeLine(wr, "info")
+	for i := 0; i < 100 && readFile(t, fileName) == ""; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if content := readFile(t, fileName); content != "info\n" {
+		t.Errorf("content after flush interval: %q", content)
+	}
+}
+
+func TestFileWriterLargeLine(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "app.log")
+	wr, err := NewFileWriterWithOptions("file", fileName, FileOptions{MaxSize: 4})
+	if err != nil {
+		t.Fatalf("create file writer error: %s", err)
+	}
+	wr.Run()
+	writeLine(wr, "larger than max size")
+	writeLine(wr, "another large line")
+	wr.Close()
+
+	if content := readFile(t, fileName); !strings.HasPrefix(content, "another") {
+		t.Errorf("large line should be written to a new file, content: %q", content)
+	}
+	if content := readFile(t, backupName(fileName, 1)); !strings.HasPrefix(content, "larger") {
+		t.Errorf("large line should be rotated, content: %q", content)
+	}
+}
+
+func TestFileWriterTimePattern(t *testing.T) {
+	dir := t.TempDir()
+	link := filepath.Join(dir, "app.log")
+	wr, err := NewFileWriterWithOptions("file", filepath.Join(dir, "app-%Y%m%d-%H%M.log"), FileOptions{Link: link})
+	if err != nil {
+		t.Fatalf("create file writer error: %s", err)
+	}
+	wr.Run()
+	writeLine(wr, "line00001")
+	wr.Close()
+
+	fileName := wr.(*fileWriter).fileName
+	if target, err := os.Readlink(link); err != nil || target != filepath.Base(fileName) {
+		t.Errorf("link target: %s, expect: %s, error: %v", target, fileName, err)
+	}
+	if content := readFile(t, link); content != "line00001\n" {
+		t.Errorf("file content: %q", content)
+	}
+}
+
+func TestFileWriterCompress(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "app.log")
+	wr, err := NewFileWriterWithOptions("file", fileName, FileOptions{MaxSize: 20, Compress: true})
+	if err != nil {
+		t.Fatalf("create file writer error: %s", err)
+	}
+	wr.Run()
+	for _, line := range []string{"line00001", "line00002", "line00003", "line00004", "line00005"} {
+		writeLine(wr, line)
+	}
+	wr.Close()
+
+	expects := map[string]string{
+		backupName(fileName, 1) + gzSuffix: "line00003\nline00004\n",
+		backupName(fileName, 2) + gzSuffix: "line00001\nline00002\n",
+	}
+	for name, expect := range expects {
+		file, err := os.Open(name)
+		if err != nil {
+			t.Fatalf("open compressed backup error: %s", err)
+		}
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatalf("read compressed backup error: %s", err)
+		}
+		data, _ := io.ReadAll(gz)
+		file.Close()
+		if string(data) != expect {
+			t.Errorf("file %s content: %q, expect: %q", name, data, expect)
+		}
+	}
+	if _, err := os.Stat(backupName(fileName, 1)); !os.IsNotExist(err) {
+		t.Errorf("uncompressed backup should be removed, error: %v", err)
+	}
+}
+
+func TestRemoveExpiredBackups(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "app.log")
+	old := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{backupName(fileName, 1), backupName(fileName, 2) + gzSuffix} {
+		if err := os.WriteFile(name, nil, 0666); err != nil {
+			t.Fatalf("write file error: %s", err)
+		}
+	}
+	os.Chtimes(backupName(fileName, 2)+gzSuffix, old, old)
+
+	if err := removeExpiredBackups(fileName, 24*time.Hour); err != nil {
+		t.Fatalf("remove expired backups error: %s", err)
+	}
+	backups, _ := listBackups(fileName)
+	if len(backups) != 1 || backups[0].index != 1 {
+		t.Errorf("expired backups should be removed, backups: %v", backups)
+	}
+}
+
+func TestSweepExpiredFiles(t *testing.T) {
+	dir := t.TempDir()
+	tp, _ := parseTimePattern(filepath.Join(dir, "app-%Y%m%d.log"))
+	worker := newBackupWorker(FileOptions{MaxAge: 24 * time.Hour}, tp)
+	old := time.Now().Add(-48 * time.Hour)
+	expired := []string{"app-20171230.log", "app-20171231.log.1", "app-20171231.log.2.gz"}
+	// siblings sharing the glob "app-*.log" must survive
+	siblings := []string{"app-other-service.log", "app-2017.log", "app-20171231.log.bak"}
+	for _, name := range append(expired, siblings...) {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0666); err != nil {
+			t.Fatalf("write file error: %s", err)
+		}
+		os.Chtimes(path, old, old)
+	}
+
+	worker.sweep(tp.format(time.Now()))
+	for _, name := range expired {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("expired file %s should be removed, error: %v", name, err)
+		}
+	}
+	for _, name := range siblings {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("file %s should be kept, error: %s", name, err)
+		}
+	}
+}
+
+func TestFileWriterRecoverPending(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "app.log")
+	// files left pending by a previous run
+	files := map[string]string{
+		fileName + pendingSuffix + "100": "line00001\n",
+		fileName + pendingSuffix + "200": "line00002\n",
+		backupName(fileName, 1):          "line00000\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0666); err != nil {
+			t.Fatalf("write file error: %s", err)
+		}
+	}
+	wr, err := NewFileWriterWithOptions("file", fileName, FileOptions{MaxSize: 20, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("create file writer error: %s", err)
+	}
+	wr.Run()
+	wr.Close()
+
+	expects := map[string]string{
+		backupName(fileName, 1): "line00002\n",
+		backupName(fileName, 2): "line00001\n",
+	}
+	for name, expect := range expects {
+		if content := readFile(t, name); content != expect {
+			t.Errorf("file %s content: %q, expect: %q", name, content, expect)
+		}
+	}
+	if pending, _ := filepath.Glob(fileName + pendingSuffix + "*"); len(pending) != 0 {
+		t.Errorf("pending files are left: %v", pending)
+	}
+	if _, err := os.Stat(backupName(fileName, 3)); !os.IsNotExist(err) {
+		t.Errorf("backup 3 should be removed, error: %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+package writer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kuun/slog/buffer"
+)
+
+// HTTPOptions are the options of http log writer
+type HTTPOptions struct {
+	// Headers are added to every request, e.g. an authorization header.
+	Headers map[string]string
+	// BatchLines is the max count of lines in a batch, 0 means
+	// DefaultBatchLines.
+	BatchLines int
+	// BatchBytes is the max size in bytes of a batch before compression,
+	// 0 means DefaultBatchBytes.
+	BatchBytes int
+	// FlushInterval is the max time a line waits in a batch, 0 means
+	// DefaultFlushInterval.
+	FlushInterval time.Duration
+	// Gzip compresses request bodies with gzip.
+	Gzip bool
+	// MaxRetries is the max count of retries of a batch failed by network
+	// errors or 5xx responses, 0 means DefaultMaxRetries, negative means
+	// no retry.
+	MaxRetries int
+	// Queue is the options of the queue of buffers being batched.
+	Queue QueueOptions
+}
+
+// default options of http log writer
+const (
+	DefaultBatchLines    = 100
+	DefaultBatchBytes    = 1 << 20
+	DefaultFlushInterval = time.Second
+	DefaultMaxRetries    = 3
+)
+
+const httpTimeout = 10 * time.Second
+
+type httpWriter struct {
+	name      string        // writer name
+	url       string        // url of ingestion endpoint
+	opts      HTTPOptions   // options
+	client    *http.Client  // http client
+	batch     bytes.Buffer  // lines of current batch
+	lines     int           // count of lines in batch
+	dropped   atomic.Uint64 // count of lines failed to post
+	queue     *queue        // buffers that will be writing
+	flushDone chan bool     // all cached buffers are posted
+	isRunning bool          // if writer's writing gorotine is running
+	runMu     sync.Mutex    // protects isRunning
+}
+
+const httpWriterCache = 256
+
+// NewHTTPWriter creates a log writer posting lines in batches to rawURL, a
+// batch is posted when it's full or it's older than FlushInterval. Every
+// request body holds lines of a batch, so it's newline-delimited json if
+// lines are formatted as json. A batch is retried with exponential backoff
+// on network errors and 5xx responses, and dropped on other failures.
+func NewHTTPWriter(name, rawURL string, opts HTTPOptions) (wr LogWriter, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("not valid http url: %s", rawURL)
+	}
+	q, err := newQueue(opts.Queue, httpWriterCache)
+	if err != nil {
+		return nil, err
+	}
+	if opts.BatchLines <= 0 {
+		opts.BatchLines = DefaultBatchLines
+	}
+	if opts.BatchBytes <= 0 {
+		opts.BatchBytes = DefaultBatchBytes
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = DefaultMaxRetries
+	}
+	return &httpWriter{
+		name:      name,
+		url:       rawURL,
+		opts:      opts,
+		client:    &http.Client{Timeout: httpTimeout},
+		queue:     q,
+		flushDone: make(chan bool),
+	}, nil
+}
+
+func (writer *httpWriter) SetName(name string) {
+	writer.name = name
+}
+
+func (writer *httpWriter) GetName() string {
+	return writer.name
+}
+
+func (writer *httpWriter) GetType() Type {
+	return HTTP
+}
+
+func (writer *httpWriter) Write(buff *buffer.Buffer) {
+	writer.queue.put(buff)
+}
+
+// Dropped returns the count of lines in batches failed to post, or dropped
+// by the overflow policy.
+func (writer *httpWriter) Dropped() uint64 {
+	return writer.dropped.Load() + writer.queue.dropped.Load()
+}
+
+// Run starts a go routine to post batches
+func (writer *httpWriter) Run() {
+	writer.runMu.Lock()
+	defer writer.runMu.Unlock()
+	if writer.isRunning {
+		return
+	}
+	go writer.run()
+	writer.isRunning = true
+}
+
+func (writer *httpWriter) run() {
+	defer close(writer.queue.stopped)
+	ticker := time.NewTicker(writer.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case buff := <-writer.queue.ch:
+			if buff == nil {
+				writer.post()
+				writer.flushDone <- true
+				continue
+			}
+			if writer.lines > 0 && writer.batch.Len()+buff.Len() > writer.opts.BatchBytes {
+				writer.post()
+			}
+			writer.batch.Write(buff.Bytes())
+			writer.lines++
+			buffer.PutBuffer(buff)
+			if writer.lines >= writer.opts.BatchLines || writer.batch.Len() >= writer.opts.BatchBytes {
+				writer.post()
+			}
+		case <-ticker.C:
+			writer.post()
+		case <-writer.queue.done:
+			writer.post()
+			return
+		}
+	}
+}
+
+// post posts current batch and starts a new one
+func (writer *httpWriter) post() {
+	if writer.lines == 0 {
+		return
+	}
+	body := writer.batch.Bytes()
+	if writer.opts.Gzip {
+		var zbuf bytes.Buffer
+		zw := gzip.NewWriter(&zbuf)
+		zw.Write(body)
+		zw.Close()
+		body = zbuf.Bytes()
+	}
+	backoff := MinBackoff
+	for retries := 0; ; retries++ {
+		retry, err := writer.postBody(body)
+		if err == nil {
+			break
+		}
+		if !retry || retries >= writer.opts.MaxRetries {
+			fmt.Fprintf(os.Stderr, "log writer %s dropped %d lines: %s\n", writer.name, writer.lines, err)
+			writer.dropped.Add(uint64(writer.lines))
+			break
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	writer.batch.Reset()
+	writer.lines = 0
+}
+
+// postBody posts a request body, retry reports whether the failure is
+// temporary.
+func (writer *httpWriter) postBody(body []byte) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, writer.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if writer.opts.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for key, value := range writer.opts.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := writer.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	return resp.StatusCode >= 500, fmt.Errorf("http status: %s", resp.Status)
+}
+
+// Flush posts all lines written before it
+func (writer *httpWriter) Flush() {
+	writer.runMu.Lock()
+	isRunning := writer.isRunning
+	writer.runMu.Unlock()
+	if !isRunning {
+		return
+	}
+	writer.Write(nil)
+	select {
+	case <-writer.flushDone:
+	case <-writer.queue.stopped:
+	}
+}
+
+// Close posts all cached lines and stops the posting go routine
+func (writer *httpWriter) Close() {
+	writer.runMu.Lock()
+	isRunning := writer.isRunning
+	writer.runMu.Unlock()
+	if !isRunning {
+		return
+	}
+	writer.Flush()
+	writer.queue.stop()
+}
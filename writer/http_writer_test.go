@@ -0,0 +1,131 @@
+package writer
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ingestServer records request bodies, it responds 503 to the first
+// failures requests.
+type ingestServer struct {
+	mu       sync.Mutex
+	failures int
+	bodies   []string
+	headers  []http.Header
+}
+
+func (s *ingestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+	data, _ := io.ReadAll(body)
+	s.bodies = append(s.bodies, string(data))
+	s.headers = append(s.headers, r.Header)
+}
+
+func (s *ingestServer) requests() ([]string, []http.Header) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bodies, s.headers
+}
+
+func TestHTTPWriterBatch(t *testing.T) {
+	s := &ingestServer{failures: 1}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	wr, err := NewHTTPWriter("http", server.URL, HTTPOptions{
+		Headers:       map[string]string{"Authorization": "Bearer token"},
+		BatchLines:    2,
+		FlushInterval: time.Hour,
+		Gzip:          true,
+	})
+	if err != nil {
+		t.Fatalf("create http writer error: %s", err)
+	}
+	wr.Run()
+	for _, line := range []string{`{"n":1}`, `{"n":2}`, `{"n":3}`} {
+		writeLine(wr, line)
+	}
+	wr.Close()
+
+	bodies, headers := s.requests()
+	want := []string{"{\"n\":1}\n{\"n\":2}\n", "{\"n\":3}\n"}
+	if len(bodies) != len(want) {
+		t.Fatalf("requests are %q, want %q", bodies, want)
+	}
+	for i := range want {
+		if bodies[i] != want[i] {
+			t.Errorf("body %d is %q, want %q", i, bodies[i], want[i])
+		}
+		if auth := headers[i].Get("Authorization"); auth != "Bearer token" {
+			t.Errorf("authorization header is %q", auth)
+		}
+		if ct := headers[i].Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("content type is %q", ct)
+		}
+	}
+	if dropped := wr.(DropCounter).Dropped(); dropped != 0 {
+		t.Errorf("dropped %d lines", dropped)
+	}
+}
+
+func TestHTTPWriterInterval(t *testing.T) {
+	s := &ingestServer{}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	wr, err := NewHTTPWriter("http", server.URL, HTTPOptions{FlushInterval: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("create http writer error: %s", err)
+	}
+	wr.Run()
+	defer wr.Close()
+	writeLine(wr, "hello")
+	for i := 0; i < 100; i++ {
+		if bodies, _ := s.requests(); len(bodies) > 0 {
+			if bodies[0] != "hello\n" {
+				t.Errorf("body is %q", bodies[0])
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("batch isn't posted after flush interval")
+}
+
+func TestHTTPWriterDrop(t *testing.T) {
+	s := &ingestServer{failures: 10}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	wr, err := NewHTTPWriter("http", server.URL, HTTPOptions{MaxRetries: 1})
+	if err != nil {
+		t.Fatalf("create http writer error: %s", err)
+	}
+	wr.Run()
+	writeLine(wr, "line1")
+	writeLine(wr, "line2")
+	wr.Close()
+	if dropped := wr.(DropCounter).Dropped(); dropped != 2 {
+		t.Errorf("dropped %d lines, want 2", dropped)
+	}
+	if _, err := NewHTTPWriter("http", "localhost:8080", HTTPOptions{}); err == nil {
+		t.Error("url without scheme is accepted")
+	}
+}
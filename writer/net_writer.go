@@ -0,0 +1,269 @@
+package writer
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kuun/slog/buffer"
+)
+
+// NetOptions are the options of network log writer
+type NetOptions struct {
+	// Backlog is the max count of lines held while the writer is
+	// disconnected, the oldest lines are dropped if it's full.
+	// 0 means DefaultBacklog.
+	Backlog int
+	// MaxBackoff is the max interval between reconnections, the interval
+	// starts from MinBackoff and doubles after every failure.
+	// 0 means DefaultMaxBackoff.
+	MaxBackoff time.Duration
+	// Queue is the options of the queue of buffers being sent, it's
+	// different from the backlog, which holds buffers taken from the queue
+	// while disconnected.
+	Queue QueueOptions
+}
+
+// default options of network log writer
+const (
+	DefaultBacklog    = 1000
+	DefaultMaxBackoff = 30 * time.Second
+	MinBackoff        = 100 * time.Millisecond
+)
+
+// timeouts of dialing and writing a line
+const (
+	netDialTimeout  = 3 * time.Second
+	netWriteTimeout = 5 * time.Second
+)
+
+// DropCounter is implemented by log writers which may drop lines
+type DropCounter interface {
+	// Dropped returns the count of lines dropped by the writer
+	Dropped() uint64
+}
+
+type netWriter struct {
+	wType     Type             // writer type, TCP or UDP
+	name      string           // writer name
+	address   string           // address of collector
+	opts      NetOptions       // options
+	conn      net.Conn         // connection to collector, nil if disconnected
+	backlog   []*buffer.Buffer // lines not sent while disconnected
+	backoff   time.Duration    // interval before next reconnection
+	dropped   atomic.Uint64    // count of dropped lines
+	reported  uint64           // count of dropped lines reported to stderr
+	queue     *queue           // buffers that will be writing
+	flushDone chan bool        // all cached buffers are sent or dropped
+	isRunning bool             // if writer's writing gorotine is running
+	runMu     sync.Mutex       // protects isRunning
+}
+
+const netWriterCache = 64
+
+// NewNetWriter creates a log writer sending lines to the collector at
+// address, wType is TCP or UDP. The writer connects in background, lines
+// are held in a bounded backlog until the connection is established, and
+// it reconnects with exponential backoff if the connection is broken.
+func NewNetWriter(wType Type, name, address string, opts NetOptions) (wr LogWriter, err error) {
+	if wType != TCP && wType != UDP {
+		return nil, fmt.Errorf("not valid network writer type: %s", wType)
+	}
+	if _, _, err = net.SplitHostPort(address); err != nil {
+		return nil, err
+	}
+	q, err := newQueue(opts.Queue, netWriterCache)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Backlog <= 0 {
+		opts.Backlog = DefaultBacklog
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DefaultMaxBackoff
+	}
+	return &netWriter{
+		wType:     wType,
+		name:      name,
+		address:   address,
+		opts:      opts,
+		queue:     q,
+		flushDone: make(chan bool),
+	}, nil
+}
+
+func (writer *netWriter) SetName(name string) {
+	writer.name = name
+}
+
+func (writer *netWriter) GetName() string {
+	return writer.name
+}
+
+func (writer *netWriter) GetType() Type {
+	return writer.wType
+}
+
+func (writer *netWriter) Write(buff *buffer.Buffer) {
+	writer.queue.put(buff)
+}
+
+// Dropped returns the count of lines dropped because the backlog is full,
+// the connection is broken while closing, or by the overflow policy.
+func (writer *netWriter) Dropped() uint64 {
+	return writer.dropped.Load() + writer.queue.dropped.Load()
+}
+
+// Run starts a go routine to send buffers to the collector
+func (writer *netWriter) Run() {
+	writer.runMu.Lock()
+	defer writer.runMu.Unlock()
+	if writer.isRunning {
+		return
+	}
+	go writer.run()
+	writer.isRunning = true
+}
+
+func (writer *netWriter) run() {
+	defer close(writer.queue.stopped)
+	// connect at once
+	retry := time.NewTimer(0)
+	defer retry.Stop()
+	closed := false
+	for {
+		select {
+		case buff := <-writer.queue.ch:
+			if buff == nil {
+				if !closed {
+					writer.close()
+					retry.Stop()
+					closed = true
+				}
+				writer.flushDone <- true
+				continue
+			}
+			if closed {
+				// a logger may write to a writer closed by reloading
+				buffer.PutBuffer(buff)
+				writer.dropped.Add(1)
+				continue
+			}
+			writer.hold(buff)
+			if writer.conn != nil && !writer.send() {
+				writer.backoff = MinBackoff
+				retry.Reset(writer.backoff)
+			}
+		case <-retry.C:
+			if closed || writer.conn != nil {
+				continue
+			}
+			if !writer.connect() {
+				retry.Reset(writer.backoff)
+			} else if !writer.send() {
+				writer.backoff = MinBackoff
+				retry.Reset(writer.backoff)
+			}
+		case <-writer.queue.done:
+			return
+		}
+	}
+}
+
+// connect connects to the collector, the backoff is doubled if it fails.
+func (writer *netWriter) connect() bool {
+	conn, err := net.DialTimeout(strings.ToLower(string(writer.wType)), writer.address, netDialTimeout)
+	if err != nil {
+		writer.backoff = nextBackoff(writer.backoff, writer.opts.MaxBackoff)
+		return false
+	}
+	writer.conn = conn
+	writer.backoff = 0
+	if dropped := writer.dropped.Load(); dropped > writer.reported {
+		fmt.Fprintf(os.Stderr, "log writer %s dropped %d lines while disconnected\n", writer.name, dropped-writer.reported)
+		writer.reported = dropped
+	}
+	return true
+}
+
+// nextBackoff doubles backoff after a failed connection, it's between
+// MinBackoff and maxBackoff.
+func nextBackoff(backoff, maxBackoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff < MinBackoff {
+		backoff = MinBackoff
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+// hold appends buff to the backlog, the oldest line is dropped if the
+// backlog is full.
+func (writer *netWriter) hold(buff *buffer.Buffer) {
+	if len(writer.backlog) >= writer.opts.Backlog {
+		buffer.PutBuffer(writer.backlog[0])
+		writer.backlog[0] = nil
+		writer.backlog = writer.backlog[1:]
+		writer.dropped.Add(1)
+	}
+	writer.backlog = append(writer.backlog, buff)
+}
+
+// send sends lines in the backlog, it stops at the first failure and closes
+// the connection, unsent lines are kept in the backlog.
+func (writer *netWriter) send() bool {
+	for i, buff := range writer.backlog {
+		writer.conn.SetWriteDeadline(time.Now().Add(netWriteTimeout))
+		if _, err := writer.conn.Write(buff.Bytes()); err != nil {
+			writer.conn.Close()
+			writer.conn = nil
+			n := copy(writer.backlog, writer.backlog[i:])
+			clear(writer.backlog[n:])
+			writer.backlog = writer.backlog[:n]
+			return false
+		}
+		buffer.PutBuffer(buff)
+	}
+	clear(writer.backlog)
+	writer.backlog = writer.backlog[:0]
+	return true
+}
+
+// close sends the backlog, reconnecting once if it's disconnected, lines
+// can't be sent are dropped.
+func (writer *netWriter) close() {
+	if writer.conn != nil || writer.connect() {
+		writer.send()
+	}
+	for _, buff := range writer.backlog {
+		buffer.PutBuffer(buff)
+	}
+	writer.dropped.Add(uint64(len(writer.backlog)))
+	writer.backlog = nil
+	if writer.conn != nil {
+		writer.conn.Close()
+		writer.conn = nil
+	}
+}
+
+// Close sends the backlog and stops the writing go routine
+func (writer *netWriter) Close() {
+	writer.runMu.Lock()
+	isRunning := writer.isRunning
+	writer.runMu.Unlock()
+	if !isRunning {
+		return
+	}
+	writer.Write(nil)
+	select {
+	case <-writer.flushDone:
+	case <-writer.queue.stopped:
+	}
+	writer.queue.stop()
+}
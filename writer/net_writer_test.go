@@ -0,0 +1,95 @@
+package writer
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNetWriterBacklog(t *testing.T) {
+	// get a free port, nothing listens on it until lines are written
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error: %s", err)
+	}
+	address := l.Addr().String()
+	l.Close()
+
+	wr, err := NewNetWriter(TCP, "net", address, NetOptions{Backlog: 3, MaxBackoff: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("create net writer error: %s", err)
+	}
+	wr.Run()
+	for _, line := range []string{"line1", "line2", "line3", "line4", "line5"} {
+		writeLine(wr, line)
+	}
+	for i := 0; i < 100 && wr.(DropCounter).Dropped() < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	l, err = net.Listen("tcp", address)
+	if err != nil {
+		t.Skipf("listen again error: %s", err)
+	}
+	defer l.Close()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("accept error: %s", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	// the oldest lines are dropped
+	for _, want := range []string{"line3\n", "line4\n", "line5\n"} {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read error: %s", err)
+		}
+		if line != want {
+			t.Errorf("line is %q, want %q", line, want)
+		}
+	}
+	writeLine(wr, "line6")
+	if line, _ := r.ReadString('\n'); line != "line6\n" {
+		t.Errorf("line is %q, want %q", line, "line6\n")
+	}
+	wr.Close()
+	if dropped := wr.(DropCounter).Dropped(); dropped != 2 {
+		t.Errorf("dropped %d lines, want 2", dropped)
+	}
+}
+
+func TestNetWriterUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error: %s", err)
+	}
+	defer pc.Close()
+	wr, err := NewNetWriter(UDP, "net", pc.LocalAddr().String(), NetOptions{})
+	if err != nil {
+		t.Fatalf("create net writer error: %s", err)
+	}
+	wr.Run()
+	defer wr.Close()
+	writeLine(wr, "hello")
+
+	buf := make([]byte, 1024)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read error: %s", err)
+	}
+	if string(buf[:n]) != "hello\n" {
+		t.Errorf("datagram is %q", buf[:n])
+	}
+}
+
+func TestNetWriterInvalid(t *testing.T) {
+	if _, err := NewNetWriter(TCP, "net", "localhost", NetOptions{}); err == nil {
+		t.Error("address without port is accepted")
+	}
+	if _, err := NewNetWriter(FILE, "net", "localhost:514", NetOptions{}); err == nil {
+		t.Error("FILE type is accepted")
+	}
+}
@@ -0,0 +1,141 @@
+package writer
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/kuun/slog/buffer"
+)
+
+// Overflow is the policy of a log writer when its queue is full
+type Overflow string
+
+// overflow policies
+const (
+	// OverflowBlock blocks the logging goroutine until the queue has room,
+	// it's the default policy.
+	OverflowBlock Overflow = "block"
+	// OverflowDropNewest drops the record being written.
+	OverflowDropNewest Overflow = "drop-newest"
+	// OverflowDropOldest drops the oldest record in the queue.
+	OverflowDropOldest Overflow = "drop-oldest"
+	// OverflowDropBelowLevel drops the record being written if its level
+	// is below QueueOptions.Level, or blocks otherwise.
+	OverflowDropBelowLevel Overflow = "drop-below-level"
+)
+
+// QueueOptions are the options of the queue between loggers and the writing
+// goroutine of a log writer.
+type QueueOptions struct {
+	// Size is the capacity of the queue, 0 means the default size of the
+	// writer.
+	Size int
+	// Overflow is the policy when the queue is full, empty means
+	// OverflowBlock.
+	Overflow Overflow
+	// Level is the level of slog, records below it are dropped when the
+	// queue is full by OverflowDropBelowLevel.
+	Level int
+}
+
+// queue is a bounded queue of buffers, a nil buffer is a flush request of
+// the writer, it's never dropped until the queue is stopped.
+type queue struct {
+	ch       chan *buffer.Buffer
+	opts     QueueOptions
+	dropped  atomic.Uint64 // count of dropped buffers
+	done     chan struct{} // closed by stop, the writing go routine exits
+	stopped  chan struct{} // closed by the writing go routine when it exits
+	stopOnce sync.Once
+}
+
+func newQueue(opts QueueOptions, defaultSize int) (*queue, error) {
+	if opts.Size < 0 {
+		return nil, errors.New("queue size can't be negative")
+	}
+	if opts.Size == 0 {
+		opts.Size = defaultSize
+	}
+	switch opts.Overflow {
+	case "":
+		opts.Overflow = OverflowBlock
+	case OverflowBlock, OverflowDropNewest, OverflowDropOldest, OverflowDropBelowLevel:
+	default:
+		return nil, errors.New("unknown overflow policy: " + string(opts.Overflow))
+	}
+	return &queue{
+		ch:      make(chan *buffer.Buffer, opts.Size),
+		opts:    opts,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}, nil
+}
+
+// put puts buff into the queue, or drops a buffer as the overflow policy
+// specified if the queue is full.
+func (q *queue) put(buff *buffer.Buffer) {
+	if buff == nil || q.opts.Overflow == OverflowBlock {
+		q.send(buff)
+		return
+	}
+	select {
+	case q.ch <- buff:
+		return
+	default:
+	}
+	switch q.opts.Overflow {
+	case OverflowDropNewest:
+		q.drop(buff)
+	case OverflowDropBelowLevel:
+		if buff.Level < q.opts.Level {
+			q.drop(buff)
+		} else {
+			q.send(buff)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case old := <-q.ch:
+				if old == nil {
+					// keep the flush request, it's rare that records are
+					// written while the writer is being closed
+					q.send(old)
+					q.drop(buff)
+					return
+				}
+				q.drop(old)
+			default:
+			}
+			select {
+			case q.ch <- buff:
+				return
+			default:
+			}
+		}
+	}
+}
+
+// send puts buff into the queue, it blocks until there is room, or drops
+// buff if the queue is stopped, so loggers never block on a closed writer.
+func (q *queue) send(buff *buffer.Buffer) {
+	select {
+	case q.ch <- buff:
+	case <-q.done:
+		if buff != nil {
+			q.drop(buff)
+		}
+	}
+}
+
+// stop makes the writing go routine exit and waits for it, buffers left in
+// the queue are discarded. It must be called only if the go routine runs.
+func (q *queue) stop() {
+	q.stopOnce.Do(func() { close(q.done) })
+	<-q.stopped
+}
+
+func (q *queue) drop(buff *buffer.Buffer) {
+	buffer.PutBuffer(buff)
+	q.dropped.Add(1)
+}
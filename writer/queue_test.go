@@ -0,0 +1,74 @@
+package writer
+
+import (
+	"strings"
+	"testing"
+)
+
+// drain returns lines in q
+func drain(q *queue) (lines []string) {
+	for len(q.ch) > 0 {
+		lines = append(lines, strings.TrimSuffix((<-q.ch).String(), "\n"))
+	}
+	return lines
+}
+
+func TestQueueOverflow(t *testing.T) {
+	tests := []struct {
+		overflow Overflow
+		want     []string
+		dropped  uint64
+	}{
+		{OverflowDropNewest, []string{"1", "2"}, 3},
+		{OverflowDropOldest, []string{"4", "5"}, 3},
+		{OverflowDropBelowLevel, []string{"1", "2"}, 3},
+	}
+	for _, test := range tests {
+		q, err := newQueue(QueueOptions{Size: 2, Overflow: test.overflow, Level: 4}, 10)
+		if err != nil {
+			t.Fatalf("create queue error: %s", err)
+		}
+		for _, line := range []string{"1", "2", "3", "4", "5"} {
+			q.put(lineBuffer(1, line))
+		}
+		if lines := drain(q); len(lines) != 2 || lines[0] != test.want[0] || lines[1] != test.want[1] {
+			t.Errorf("%s: lines are %q, want %q", test.overflow, lines, test.want)
+		}
+		if dropped := q.dropped.Load(); dropped != test.dropped {
+			t.Errorf("%s: dropped %d, want %d", test.overflow, dropped, test.dropped)
+		}
+	}
+}
+
+func TestQueueDropBelowLevel(t *testing.T) {
+	q, _ := newQueue(QueueOptions{Size: 1, Overflow: OverflowDropBelowLevel, Level: 4}, 10)
+	q.put(lineBuffer(1, "info"))
+	done := make(chan bool)
+	go func() {
+		// blocks until there is room
+		q.put(lineBuffer(4, "error"))
+		done <- true
+	}()
+	if line := (<-q.ch).String(); line != "info\n" {
+		t.Errorf("first line is %q", line)
+	}
+	<-done
+	if line := (<-q.ch).String(); line != "error\n" {
+		t.Errorf("second line is %q", line)
+	}
+	if dropped := q.dropped.Load(); dropped != 0 {
+		t.Errorf("dropped %d lines", dropped)
+	}
+}
+
+func TestQueueOptions(t *testing.T) {
+	if q, _ := newQueue(QueueOptions{}, 10); cap(q.ch) != 10 || q.opts.Overflow != OverflowBlock {
+		t.Errorf("default queue options error: %d, %s", cap(q.ch), q.opts.Overflow)
+	}
+	if _, err := newQueue(QueueOptions{Overflow: "none"}, 10); err == nil {
+		t.Error("unknown overflow policy is accepted")
+	}
+	if _, err := newQueue(QueueOptions{Size: -1}, 10); err == nil {
+		t.Error("negative queue size is accepted")
+	}
+}
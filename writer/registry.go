@@ -0,0 +1,47 @@
+package writer
+
+import (
+	"sync"
+)
+
+// Factory creates a log writer of a registered type, conf holds the options
+// of the writer configuration.
+type Factory func(conf map[string]interface{}) (LogWriter, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[Type]Factory)
+)
+
+// builtinTypes are types of writers created by slog, they can't be
+// registered.
+var builtinTypes = map[Type]bool{FILE: true, SYSLOG: true, TCP: true, UDP: true, HTTP: true, RING: true}
+
+// Register makes a writer type available to slog configuration, writers of
+// typeName are created by factory with the "options" object of their
+// configuration, and named by SetName. It's usually called in an init
+// function, it panics if typeName is empty, built-in or registered twice,
+// or factory is nil.
+func Register(typeName string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	t := Type(typeName)
+	if factory == nil {
+		panic("writer: Register factory is nil, type: " + typeName)
+	}
+	if t == "" || builtinTypes[t] {
+		panic("writer: Register can't register type: '" + typeName + "'")
+	}
+	if _, dup := factories[t]; dup {
+		panic("writer: Register called twice for type: " + typeName)
+	}
+	factories[t] = factory
+}
+
+// Lookup returns the factory of a registered writer type
+func Lookup(typeName string) (factory Factory, ok bool) {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	factory, ok = factories[Type(typeName)]
+	return factory, ok
+}
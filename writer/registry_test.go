@@ -0,0 +1,35 @@
+package writer
+
+import (
+	"testing"
+)
+
+func newCaptureWriter(conf map[string]interface{}) (LogWriter, error) {
+	return &captureWriter{}, nil
+}
+
+// the registry is global, the type is registered once however many times
+// tests run by -count
+func init() {
+	Register("REGISTRYTEST", newCaptureWriter)
+}
+
+func TestRegister(t *testing.T) {
+	if f, ok := Lookup("REGISTRYTEST"); !ok || f == nil {
+		t.Error("registered type isn't found")
+	}
+	if _, ok := Lookup("NONE"); ok {
+		t.Error("type not registered is found")
+	}
+
+	for _, typeName := range []string{"REGISTRYTEST", FILE, ""} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("type %q is registered", typeName)
+				}
+			}()
+			Register(typeName, newCaptureWriter)
+		}()
+	}
+}
@@ -0,0 +1,117 @@
+package writer
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/kuun/slog/buffer"
+)
+
+// DefaultRingSize is the default count of lines kept by ring log writer
+const DefaultRingSize = 1000
+
+type ringWriter struct {
+	name   string           // writer name
+	mu     sync.Mutex       // protects fields below
+	lines  []*buffer.Buffer // kept lines, lines[next] is the oldest if full
+	next   int              // index of next line
+	full   bool             // if lines is full
+	target LogWriter        // lines are dumped to target
+}
+
+// NewRingWriter creates a log writer keeping the last size lines in memory,
+// the lines are dumped to the target writer when an ERROR or FATAL line is
+// written, ending with the line. size 0 means DefaultRingSize.
+func NewRingWriter(name string, size int) (wr LogWriter, err error) {
+	if size < 0 {
+		return nil, errors.New("ring size can't be negative")
+	}
+	if size == 0 {
+		size = DefaultRingSize
+	}
+	return &ringWriter{name: name, lines: make([]*buffer.Buffer, size)}, nil
+}
+
+// SetRingTarget sets the writer which the ring writer wr dumps lines to,
+// target can't be a ring writer.
+func SetRingTarget(wr, target LogWriter) error {
+	ring, ok := wr.(*ringWriter)
+	if !ok {
+		return errors.New("not a ring writer: " + wr.GetName())
+	}
+	if target.GetType() == RING {
+		return errors.New("ring writer can't dump to ring writer: " + target.GetName())
+	}
+	ring.mu.Lock()
+	ring.target = target
+	ring.mu.Unlock()
+	return nil
+}
+
+func (writer *ringWriter) SetName(name string) {
+	writer.name = name
+}
+
+func (writer *ringWriter) GetName() string {
+	return writer.name
+}
+
+func (writer *ringWriter) GetType() Type {
+	return RING
+}
+
+func (writer *ringWriter) Write(buff *buffer.Buffer) {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+	if old := writer.lines[writer.next]; old != nil {
+		buffer.PutBuffer(old)
+	}
+	writer.lines[writer.next] = buff
+	writer.next++
+	if writer.next == len(writer.lines) {
+		writer.next = 0
+		writer.full = true
+	}
+	if buff.Level >= errorLevel {
+		writer.dump()
+	}
+}
+
+// dump writes kept lines to target from the oldest one, and clears them
+func (writer *ringWriter) dump() {
+	start := 0
+	if writer.full {
+		start = writer.next
+	}
+	for i := 0; i < len(writer.lines); i++ {
+		j := (start + i) % len(writer.lines)
+		if buff := writer.lines[j]; buff != nil {
+			if writer.target != nil {
+				writer.target.Write(buff)
+			} else {
+				buffer.PutBuffer(buff)
+			}
+			writer.lines[j] = nil
+		}
+	}
+	writer.next = 0
+	writer.full = false
+}
+
+// Run does nothing, lines are kept by Write
+func (writer *ringWriter) Run() {
+}
+
+// Close drops kept lines
+func (writer *ringWriter) Close() {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+	for i, buff := range writer.lines {
+		if buff != nil {
+			buffer.PutBuffer(buff)
+			writer.lines[i] = nil
+		}
+	}
+	writer.next = 0
+	writer.full = false
+}
@@ -0,0 +1,62 @@
+package writer
+
+import (
+	"testing"
+
+	"github.com/kuun/slog/buffer"
+)
+
+// captureWriter keeps lines written to it
+type captureWriter struct {
+	lines []string
+}
+
+func (w *captureWriter) SetName(name string) {}
+func (w *captureWriter) GetName() string     { return "capture" }
+func (w *captureWriter) GetType() Type       { return "CAPTURE" }
+func (w *captureWriter) Run()                {}
+func (w *captureWriter) Close()              {}
+
+func (w *captureWriter) Write(buff *buffer.Buffer) {
+	w.lines = append(w.lines, buff.String())
+	buffer.PutBuffer(buff)
+}
+
+func TestRingWriter(t *testing.T) {
+	wr, err := NewRingWriter("ring", 3)
+	if err != nil {
+		t.Fatalf("create ring writer error: %s", err)
+	}
+	target := &captureWriter{}
+	if err = SetRingTarget(wr, target); err != nil {
+		t.Fatalf("set ring target error: %s", err)
+	}
+	for _, line := range []string{"1", "2", "3", "4", "5"} {
+		writeLevelLine(wr, 0, line)
+	}
+	if len(target.lines) != 0 {
+		t.Errorf("lines are dumped before error: %q", target.lines)
+	}
+	writeLevelLine(wr, 4, "error")
+	expects := []string{"4\n", "5\n", "error\n"}
+	if len(target.lines) != len(expects) {
+		t.Fatalf("dumped lines: %q, expect: %q", target.lines, expects)
+	}
+	for i, expect := range expects {
+		if target.lines[i] != expect {
+			t.Errorf("dumped lines: %q, expect: %q", target.lines, expects)
+			break
+		}
+	}
+
+	// dumped lines are cleared
+	writeLevelLine(wr, 5, "fatal")
+	if len(target.lines) != 4 || target.lines[3] != "fatal\n" {
+		t.Errorf("dumped lines: %q", target.lines)
+	}
+	wr.Close()
+
+	if err = SetRingTarget(wr, wr); err == nil {
+		t.Error("ring writer is set as target of ring writer")
+	}
+}
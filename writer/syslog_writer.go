@@ -0,0 +1,309 @@
+package writer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kuun/slog/buffer"
+)
+
+// SyslogOptions are the options of syslog log writer
+type SyslogOptions struct {
+	// Network is "udp", "tcp", "unix" or "unixgram", empty means the local
+	// syslog daemon, e.g. "/dev/log".
+	Network string
+	// Address is the address of syslog server, e.g. "localhost:514", or
+	// the path of a unix socket.
+	Address string
+	// Facility is the facility name, e.g. "local0", "user" if empty.
+	Facility string
+	// AppName is the APP-NAME of messages, the program name if empty.
+	AppName string
+	// Queue is the options of the queue of buffers being sent.
+	Queue QueueOptions
+}
+
+// facilities of syslog, RFC 5424 section 6.2.1
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// syslogSeverities maps levels of slog, DEBUG to FATAL, to syslog
+// severities, FATAL is mapped to critical.
+var syslogSeverities = [6]int{7, 6, 5, 4, 3, 2}
+
+// unix sockets of local syslog daemon
+var syslogLocalAddrs = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+const syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+type syslogWriter struct {
+	name      string        // writer name
+	opts      SyslogOptions // options, Network and Address are set by dial
+	facility  int           // facility code
+	header    string        // " HOSTNAME APP-NAME PROCID MSGID SD " part of header
+	conn      net.Conn      // connection to syslog server, nil if disconnected
+	nextDial  time.Time     // lines are dropped until it while disconnected
+	backoff   time.Duration // interval before next reconnection
+	dropped   atomic.Uint64 // count of lines dropped while disconnected
+	reported  uint64        // count of dropped lines reported to stderr
+	queue     *queue        // buffers that will be writing
+	flushDone chan bool     // all cached buffers are written
+	isRunning bool          // if writer's writing gorotine is running
+	runMu     sync.Mutex    // protects isRunning
+}
+
+const syslogWriterCache = 64
+
+// NewSyslogWriter creates a syslog log writer, it writes every buffer as a
+// RFC 5424 message whose severity is mapped from the level of the buffer.
+// Messages are framed by octet counting over tcp, one message per datagram
+// over udp and unixgram, and terminated by a new line over unix stream.
+//
+// The local syslog daemon is connected at once, a syslog server at Address
+// is connected in background. If the connection is broken, it reconnects
+// with exponential backoff, lines written while disconnected are dropped.
+func NewSyslogWriter(name string, opts SyslogOptions) (wr LogWriter, err error) {
+	if opts.Facility == "" {
+		opts.Facility = "user"
+	}
+	facility, ok := syslogFacilities[opts.Facility]
+	if !ok {
+		return nil, errors.New("unknown syslog facility: " + opts.Facility)
+	}
+	if opts.AppName == "" {
+		opts.AppName = filepath.Base(os.Args[0])
+	}
+	q, err := newQueue(opts.Queue, syslogWriterCache)
+	if err != nil {
+		return nil, err
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	writer := &syslogWriter{
+		name:      name,
+		opts:      opts,
+		facility:  facility,
+		header:    " " + headerField(hostname) + " " + headerField(opts.AppName) + " " + strconv.Itoa(os.Getpid()) + " - - ",
+		queue:     q,
+		flushDone: make(chan bool),
+	}
+	switch opts.Network {
+	case "":
+		if err = writer.dial(); err != nil {
+			return nil, err
+		}
+	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6":
+		if _, _, err = net.SplitHostPort(opts.Address); err != nil {
+			return nil, err
+		}
+	}
+	return writer, nil
+}
+
+// headerField replaces characters not allowed in header fields by '_',
+// "-" is the nil value of an empty field.
+func headerField(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+func (writer *syslogWriter) dial() error {
+	if writer.opts.Network != "" {
+		conn, err := net.DialTimeout(writer.opts.Network, writer.opts.Address, netDialTimeout)
+		if err != nil {
+			return err
+		}
+		writer.conn = conn
+		return nil
+	}
+	addrs := syslogLocalAddrs
+	if writer.opts.Address != "" {
+		addrs = []string{writer.opts.Address}
+	}
+	for _, network := range []string{"unixgram", "unix"} {
+		for _, addr := range addrs {
+			if conn, err := net.DialTimeout(network, addr, netDialTimeout); err == nil {
+				writer.conn = conn
+				writer.opts.Network = network
+				writer.opts.Address = addr
+				return nil
+			}
+		}
+	}
+	return errors.New("can't connect to local syslog daemon")
+}
+
+func (writer *syslogWriter) SetName(name string) {
+	writer.name = name
+}
+
+func (writer *syslogWriter) GetName() string {
+	return writer.name
+}
+
+func (writer *syslogWriter) GetType() Type {
+	return SYSLOG
+}
+
+func (writer *syslogWriter) Write(buff *buffer.Buffer) {
+	writer.queue.put(buff)
+}
+
+// Dropped returns the count of lines dropped while disconnected, or by the
+// overflow policy.
+func (writer *syslogWriter) Dropped() uint64 {
+	return writer.dropped.Load() + writer.queue.dropped.Load()
+}
+
+// Run starts a go routine to send buffers to syslog server
+func (writer *syslogWriter) Run() {
+	writer.runMu.Lock()
+	defer writer.runMu.Unlock()
+	if writer.isRunning {
+		return
+	}
+	go func() {
+		defer close(writer.queue.stopped)
+		msg := new(bytes.Buffer)
+		for {
+			select {
+			case buff := <-writer.queue.ch:
+				if buff == nil {
+					writer.flushDone <- true
+					continue
+				}
+				writer.format(msg, buff)
+				buffer.PutBuffer(buff)
+				writer.send(msg.Bytes())
+			case <-writer.queue.done:
+				return
+			}
+		}
+	}()
+	writer.isRunning = true
+}
+
+// format formats buff as a syslog message in msg, including the frame
+func (writer *syslogWriter) format(msg *bytes.Buffer, buff *buffer.Buffer) {
+	level := buff.Level
+	if level < 0 || level >= len(syslogSeverities) {
+		level = 0
+	}
+	msg.Reset()
+	// reserve room for the octet count
+	msg.WriteString("          ")
+	start := msg.Len()
+	msg.WriteByte('<')
+	msg.WriteString(strconv.Itoa(writer.facility*8 + syslogSeverities[level]))
+	msg.WriteString(">1 ")
+	msg.WriteString(time.Now().Format(syslogTimeFormat))
+	msg.WriteString(writer.header)
+	msg.Write(bytes.TrimRight(buff.Bytes(), "\n"))
+	switch writer.opts.Network {
+	case "tcp", "tcp4", "tcp6":
+		count := strconv.Itoa(msg.Len()-start) + " "
+		data := msg.Bytes()
+		copy(data[start-len(count):], count)
+		msg.Next(start - len(count))
+		return
+	case "unix":
+		msg.WriteByte('\n')
+	}
+	msg.Next(start)
+}
+
+// send sends a message, it reconnects once if the connection is broken. The
+// message is dropped if it can't be sent, or if it's disconnected and the
+// backoff of reconnection isn't passed.
+func (writer *syslogWriter) send(msg []byte) {
+	if writer.conn != nil && writer.write(msg) {
+		return
+	}
+	if time.Now().Before(writer.nextDial) || !writer.connect() || !writer.write(msg) {
+		writer.dropped.Add(1)
+	}
+}
+
+// write writes a message to the connection, the connection is closed if it
+// fails.
+func (writer *syslogWriter) write(msg []byte) bool {
+	writer.conn.SetWriteDeadline(time.Now().Add(netWriteTimeout))
+	if _, err := writer.conn.Write(msg); err != nil {
+		writer.conn.Close()
+		writer.conn = nil
+		return false
+	}
+	return true
+}
+
+// connect connects to the syslog server, the backoff is doubled if it fails.
+func (writer *syslogWriter) connect() bool {
+	if err := writer.dial(); err != nil {
+		writer.backoff = nextBackoff(writer.backoff, DefaultMaxBackoff)
+		writer.nextDial = time.Now().Add(writer.backoff)
+		return false
+	}
+	writer.backoff = 0
+	if dropped := writer.dropped.Load(); dropped > writer.reported {
+		fmt.Fprintf(os.Stderr, "log writer %s dropped %d lines while disconnected\n", writer.name, dropped-writer.reported)
+		writer.reported = dropped
+	}
+	return true
+}
+
+// Close sends all cached buffers, stops the writing go routine and closes
+// the connection.
+func (writer *syslogWriter) Close() {
+	writer.runMu.Lock()
+	isRunning := writer.isRunning
+	writer.runMu.Unlock()
+	if isRunning {
+		writer.Write(nil)
+		select {
+		case <-writer.flushDone:
+		case <-writer.queue.stopped:
+		}
+		writer.queue.stop()
+	}
+	if writer.conn != nil {
+		writer.conn.Close()
+	}
+}
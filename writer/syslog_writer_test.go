@@ -0,0 +1,136 @@
+package writer
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var syslogMsgRegexp = regexp.MustCompile(`^<(\d+)>1 \S+ \S+ app ` + strconv.Itoa(os.Getpid()) + ` - - (.*)$`)
+
+func checkSyslogMsg(t *testing.T, msg string, pri int, text string) {
+	t.Helper()
+	m := syslogMsgRegexp.FindStringSubmatch(msg)
+	if m == nil {
+		t.Fatalf("invalid syslog message: %q", msg)
+	}
+	if m[1] != strconv.Itoa(pri) || m[2] != text {
+		t.Errorf("syslog message is %q, want pri %d and text %q", msg, pri, text)
+	}
+}
+
+func TestSyslogWriterUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error: %s", err)
+	}
+	defer pc.Close()
+	wr, err := NewSyslogWriter("syslog", SyslogOptions{
+		Network:  "udp",
+		Address:  pc.LocalAddr().String(),
+		Facility: "local0",
+		AppName:  "app",
+	})
+	if err != nil {
+		t.Fatalf("create syslog writer error: %s", err)
+	}
+	wr.Run()
+	defer wr.Close()
+	writeLevelLine(wr, 1, "hello")
+	writeLevelLine(wr, 5, "fatal")
+
+	buf := make([]byte, 1024)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, want := range []struct {
+		pri  int
+		text string
+	}{{16*8 + 6, "hello"}, {16*8 + 2, "fatal"}} {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("read error: %s", err)
+		}
+		checkSyslogMsg(t, string(buf[:n]), want.pri, want.text)
+	}
+}
+
+func TestSyslogWriterTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error: %s", err)
+	}
+	defer l.Close()
+	wr, err := NewSyslogWriter("syslog", SyslogOptions{Network: "tcp", Address: l.Addr().String(), AppName: "app"})
+	if err != nil {
+		t.Fatalf("create syslog writer error: %s", err)
+	}
+	wr.Run()
+	writeLevelLine(wr, 0, "first line")
+	writeLevelLine(wr, 3, "second line")
+	wr.Close()
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("accept error: %s", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	for _, want := range []struct {
+		pri  int
+		text string
+	}{{8 + 7, "first line"}, {8 + 4, "second line"}} {
+		count, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatalf("read octet count error: %s", err)
+		}
+		n, err := strconv.Atoi(count[:len(count)-1])
+		if err != nil {
+			t.Fatalf("invalid octet count: %q", count)
+		}
+		msg := make([]byte, n)
+		if _, err = io.ReadFull(r, msg); err != nil {
+			t.Fatalf("read message error: %s", err)
+		}
+		checkSyslogMsg(t, string(msg), want.pri, want.text)
+	}
+}
+
+func TestSyslogWriterUnreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error: %s", err)
+	}
+	address := l.Addr().String()
+	l.Close()
+	wr, err := NewSyslogWriter("syslog", SyslogOptions{Network: "tcp", Address: address, AppName: "app"})
+	if err != nil {
+		t.Fatalf("create syslog writer error: %s", err)
+	}
+	wr.Run()
+	start := time.Now()
+	// the first line fails to connect, others are dropped during backoff
+	for _, line := range []string{"1", "2", "3"} {
+		writeLevelLine(wr, 1, line)
+	}
+	wr.Close()
+	if dropped := wr.(DropCounter).Dropped(); dropped != 3 {
+		t.Errorf("dropped %d lines, want 3", dropped)
+	}
+	if elapsed := time.Since(start); elapsed > netDialTimeout {
+		t.Errorf("writing to unreachable server takes %s", elapsed)
+	}
+	if _, err := NewSyslogWriter("syslog", SyslogOptions{Network: "tcp", Address: "localhost"}); err == nil {
+		t.Error("address without port is accepted")
+	}
+}
+
+func TestSyslogWriterFacility(t *testing.T) {
+	if _, err := NewSyslogWriter("syslog", SyslogOptions{Network: "udp", Address: "127.0.0.1:514", Facility: "bad"}); err == nil {
+		t.Error("unknown facility is accepted")
+	}
+}
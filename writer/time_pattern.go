@@ -0,0 +1,195 @@
+package writer
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// period is the interval at which a time pattern names a new file
+type period int
+
+const (
+	noPeriod period = iota
+	periodYear
+	periodMonth
+	periodDay
+	periodHour
+	periodMinute
+)
+
+// timePattern is a file name with strftime style conversions, supported
+// conversions are:
+//
+//	%Y  year, 4 digits
+//	%y  year, 2 digits
+//	%m  month, 01-12
+//	%d  day of month, 01-31
+//	%H  hour, 00-23
+//	%M  minute, 00-59
+//	%%  a literal '%'
+type timePattern struct {
+	pattern string
+	period  period         // the shortest period among conversions of the pattern
+	files   *regexp.Regexp // matches files of all periods and their backups
+}
+
+// isTimePattern reports whether fileName contains strftime conversions.
+func isTimePattern(fileName string) bool {
+	return strings.Contains(strings.ReplaceAll(fileName, "%%", ""), "%")
+}
+
+func parseTimePattern(pattern string) (*timePattern, error) {
+	tp := &timePattern{pattern: pattern}
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' {
+			continue
+		}
+		if i+1 == len(pattern) {
+			return nil, errors.New("time pattern ends with '%': " + pattern)
+		}
+		i++
+		var p period
+		switch pattern[i] {
+		case 'Y', 'y':
+			p = periodYear
+		case 'm':
+			p = periodMonth
+		case 'd':
+			p = periodDay
+		case 'H':
+			p = periodHour
+		case 'M':
+			p = periodMinute
+		case '%':
+			continue
+		default:
+			return nil, errors.New("unkown conversion '%" + pattern[i:i+1] + "' in time pattern: " + pattern)
+		}
+		if p > tp.period {
+			tp.period = p
+		}
+	}
+	if tp.period == noPeriod {
+		return nil, errors.New("no time conversion in time pattern: " + pattern)
+	}
+	tp.files = tp.filesRegexp()
+	return tp, nil
+}
+
+// format returns the file name of the period which t belongs to.
+func (tp *timePattern) format(t time.Time) string {
+	var b strings.Builder
+	pattern := tp.pattern
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i+1 == len(pattern) {
+			b.WriteByte(pattern[i])
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case 'Y':
+			b.WriteString(strconv.Itoa(t.Year()))
+		case 'y':
+			writeTwoDigits(&b, t.Year()%100)
+		case 'm':
+			writeTwoDigits(&b, int(t.Month()))
+		case 'd':
+			writeTwoDigits(&b, t.Day())
+		case 'H':
+			writeTwoDigits(&b, t.Hour())
+		case 'M':
+			writeTwoDigits(&b, t.Minute())
+		default:
+			b.WriteByte(pattern[i])
+		}
+	}
+	return b.String()
+}
+
+func writeTwoDigits(b *strings.Builder, d int) {
+	b.WriteByte(byte('0' + d/10))
+	b.WriteByte(byte('0' + d%10))
+}
+
+// next returns the start of the period following the one t belongs to.
+func (tp *timePattern) next(t time.Time) time.Time {
+	year, month, day := t.Date()
+	hour, minute, _ := t.Clock()
+	loc := t.Location()
+	switch tp.period {
+	case periodYear:
+		return time.Date(year+1, 1, 1, 0, 0, 0, 0, loc)
+	case periodMonth:
+		return time.Date(year, month+1, 1, 0, 0, 0, 0, loc)
+	case periodDay:
+		return time.Date(year, month, day+1, 0, 0, 0, 0, loc)
+	case periodHour:
+		return time.Date(year, month, day, hour+1, 0, 0, 0, loc)
+	default:
+		return time.Date(year, month, day, hour, minute+1, 0, 0, loc)
+	}
+}
+
+// glob returns a glob pattern matching files of all periods.
+func (tp *timePattern) glob() string {
+	var b strings.Builder
+	pattern := tp.pattern
+	star := false // adjacent conversions are matched by one '*'
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c == '%' && i+1 < len(pattern) && pattern[i+1] != '%' {
+			i++
+			if !star {
+				b.WriteByte('*')
+			}
+			star = true
+			continue
+		}
+		star = false
+		switch {
+		case c == '%':
+			i++
+			b.WriteByte('%')
+		case c == '*' || c == '?' || c == '[' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// filesRegexp returns a regexp matching cleaned paths of files of all periods,
+// with an optional backup index and gzip suffix, e.g. "app-20171231.log.1.gz".
+// Every conversion is matched by its fixed count of digits, so files which
+// only share the glob of the pattern are not matched.
+func (tp *timePattern) filesRegexp() *regexp.Regexp {
+	var b strings.Builder
+	b.WriteByte('^')
+	pattern := filepath.Clean(tp.pattern)
+	literal := 0 // start of the literal text before a conversion
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i+1 == len(pattern) {
+			continue
+		}
+		b.WriteString(regexp.QuoteMeta(pattern[literal:i]))
+		i++
+		literal = i + 1
+		switch pattern[i] {
+		case 'Y':
+			b.WriteString(`\d{4}`)
+		case '%':
+			b.WriteString("%")
+		default:
+			b.WriteString(`\d{2}`)
+		}
+	}
+	b.WriteString(regexp.QuoteMeta(pattern[literal:]))
+	b.WriteString(`(\.\d+)?(\.gz)?$`)
+	return regexp.MustCompile(b.String())
+}
@@ -0,0 +1,50 @@
+package writer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimePattern(t *testing.T) {
+	tp, err := parseTimePattern("/var/log/app-%Y%m%d-%H.log")
+	if err != nil {
+		t.Fatalf("parse time pattern error: %s", err)
+	}
+	now := time.Date(2017, 12, 31, 23, 15, 0, 0, time.Local)
+	if name := tp.format(now); name != "/var/log/app-20171231-23.log" {
+		t.Errorf("format time pattern error: %s", name)
+	}
+	if next := tp.next(now); !next.Equal(time.Date(2018, 1, 1, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("next period error: %s", next)
+	}
+	if glob := tp.glob(); glob != "/var/log/app-*-*.log" {
+		t.Errorf("time pattern glob error: %s", glob)
+	}
+	for name, match := range map[string]bool{
+		"/var/log/app-20171231-23.log":      true,
+		"/var/log/app-20171231-23.log.1.gz": true,
+		"/var/log/app-other-service.log":    false,
+		"/var/log/app-2017-23.log":          false,
+		"/var/log/app-20171231-23.log.bak":  false,
+	} {
+		if tp.files.MatchString(name) != match {
+			t.Errorf("time pattern matches %s: %t", name, !match)
+		}
+	}
+
+	for _, pattern := range []string{"app-%Y%m%d%%.log", "app.log"} {
+		if tp, err := parseTimePattern(pattern); err != nil && pattern == "app.log" {
+			continue
+		} else if err != nil || tp.period != periodDay {
+			t.Errorf("parse time pattern %s error: %v", pattern, err)
+		}
+	}
+	for _, pattern := range []string{"app-%Q.log", "app-%"} {
+		if _, err := parseTimePattern(pattern); err == nil {
+			t.Errorf("invalid time pattern %s is parsed", pattern)
+		}
+	}
+	if isTimePattern("app%%.log") || !isTimePattern("app-%d.log") {
+		t.Errorf("test time pattern error")
+	}
+}
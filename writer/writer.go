@@ -8,6 +8,16 @@ type Type string
 const (
 	// FILE represents file log writer
 	FILE = "FILE"
+	// SYSLOG represents syslog log writer
+	SYSLOG = "SYSLOG"
+	// TCP represents network log writer over tcp
+	TCP = "TCP"
+	// UDP represents network log writer over udp
+	UDP = "UDP"
+	// HTTP represents http batch log writer
+	HTTP = "HTTP"
+	// RING represents in-memory ring log writer
+	RING = "RING"
 )
 
 // LogWriter is the interface of log writer, used to write log to somewhere